@@ -2,7 +2,7 @@ package cedar
 
 import (
 	"bytes"
-	"container/list"
+	"context"
 	"io/ioutil"
 	"strings"
 	"sync"
@@ -18,17 +18,37 @@ type Matcher struct {
 	da       *Cedar
 	outputs  []outNode
 	fails    []int
+	depth    []int
+	longest  []int
+	maxLen   int
+	kind     MatchKind
+	fold     FoldMode
+	norm     NormMode
+	runeMap  func(rune) rune
+	runeSafe bool
+	words    wordOptions
+	hasWords bool
 	compiled bool
+	rev      revTree
+	back     *backward
+	// keys are reversed, first holds the output inserted first of each node
+	reversed bool
+	first    []int
 }
 
 type Response struct {
-	ac  *Matcher
-	buf *mbuf
+	ac        *Matcher
+	buf       *mbuf
+	limits    matchLimits
+	matches   int
+	truncated bool
 }
 
 type mbuf struct {
 	at             []matchAt
 	nextIdx, atIdx int
+	om             offsetMap
+	rc             runeCounter
 }
 
 // MatchToken matched words in Aho Corasick Matcher
@@ -37,16 +57,22 @@ type MatchToken struct {
 	Value interface{}
 	At    int // match position of source text
 	Freq  uint
+	// rune and utf-16 offsets of the key, only set with WithRuneSafe
+	RuneStart, RuneLen   int
+	UTF16Start, UTF16Len int
 }
 
 type matchAt struct {
 	At    int
 	OutID int
+	VKey  int // the only word reported at this position, 0 for all outputs of OutID
 }
 
+// outNode is the own output of a node, link tells whether the outputs
+// of its fail node follow
 type outNode struct {
-	Link *outNode
 	vKey int
+	link bool
 }
 
 var bufPool = sync.Pool{
@@ -69,26 +95,45 @@ func NewResponse(ac *Matcher) *Response {
 	return resp
 }
 
+// maxPooledMatches is the size above which a released buffer is
+// dropped instead of being kept in the pool
+const maxPooledMatches = 16 * DefaultMatchBufferSize
+
 func (r *Response) Release() {
+	if len(r.buf.at) > maxPooledMatches || cap(r.buf.om.spans) > maxPooledMatches {
+		return
+	}
 	r.buf.reset()
 	bufPool.Put(r.buf)
 }
 
 // NewMatcher new an aho corasick matcher
-func NewMatcher() *Matcher {
-	return &Matcher{
+func NewMatcher(opts ...MatcherOption) *Matcher {
+	m := &Matcher{
 		da:       NewCedar(),
 		compiled: false,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 func (mb *mbuf) reset() {
 	mb.nextIdx, mb.atIdx = 0, 0
+	mb.om.reset()
+	mb.rc.reset()
 }
 
 func (mb *mbuf) grow() {
-	idx := mb.atIdx
-	mb.at = append(mb.at, make([]matchAt, idx, idx)...)
+	mb.growTo(max(2*mb.atIdx, DefaultMatchBufferSize))
+}
+
+// growTo extends the buffer to n positions
+func (mb *mbuf) growTo(n int) {
+	if n > len(mb.at) {
+		mb.at = append(mb.at, make([]matchAt, n-len(mb.at))...)
+	}
 }
 
 // safely grow
@@ -111,13 +156,38 @@ func (m *Matcher) DumpGraph(fname string) {
 	ioutil.WriteFile(fname, out.Bytes(), 0666)
 }
 
-// Insert a byte sequence to double array trie inner matcher
-func (m *Matcher) Insert(bs []byte, val interface{}) {
+// Insert a byte sequence to double array trie inner matcher,
+// it returns ErrInvalidKey for a blank key and ErrTooLarge if the key
+// exceeds a limit given by WithCedarOptions.
+func (m *Matcher) Insert(bs []byte, val interface{}) error {
+	_, err := m.insert(bs, val, m.words.all)
+	return err
+}
+
+// insert adds a key and returns its value key
+func (m *Matcher) insert(bs []byte, val interface{}, word bool) (int, error) {
 	if strings.TrimSpace(string(bs)) == "" {
-		// ignore empty string.
-		return
+		return 0, ErrInvalidKey
+	}
+	if m.rewrites() {
+		bs = m.foldKey(bs)
+	}
+	if err := m.da.checkInsert(bs); err != nil {
+		return 0, err
 	}
-	m.da.Insert(bs, val)
+	var k int
+	if m.compiled {
+		k = m.update(bs, val)
+	} else {
+		k = m.da.insert(bs, val)
+	}
+	if word {
+		v := m.da.vals[k]
+		v.Word = true
+		m.da.vals[k] = v
+		m.hasWords = m.hasWords || m.compiled
+	}
+	return k, nil
 }
 
 // Cedar return a cedar trie instance
@@ -125,10 +195,15 @@ func (m *Matcher) Cedar() *Cedar {
 	return m.da
 }
 
-// Compile trie to aho-corasick
-func (m *Matcher) Compile() {
+// Compile trie to aho-corasick, it returns ErrTooLarge if the trie
+// exceeds a limit given by WithCedarOptions, e.g. for a loaded Cedar.
+// Matching a matcher which fails to compile finds nothing.
+func (m *Matcher) Compile() error {
 	if m.compiled {
-		return
+		return nil
+	}
+	if err := m.da.checkLimits(); err != nil {
+		return err
 	}
 	nLen := len(m.da.array)
 	m.fails = make([]int, nLen)
@@ -137,38 +212,190 @@ func (m *Matcher) Compile() {
 	}
 
 	m.outputs = make([]outNode, nLen)
+	m.depth = make([]int, nLen)
+	m.longest = make([]int, nLen)
+	if m.reversed {
+		m.first = make([]int, nLen)
+	}
 	m.fails[0] = 0
+	m.rev = revTree{}
 	// build fail function, generate NFA
-	m.buildFails()
+	order := m.buildFails()
 	// build output function, generate DFA
-	m.buildOutputs()
+	m.buildOutputs(order)
+	m.maxLen, m.hasWords = 0, false
+	for _, v := range m.da.vals {
+		if v.Len > m.maxLen {
+			m.maxLen = v.Len
+		}
+		m.hasWords = m.hasWords || v.Word
+	}
 	m.compiled = true
+	m.resetBackward()
+	return nil
+}
+
+// ready compiles m if needed and tells whether it can be matched
+func (m *Matcher) ready() bool {
+	return m.Compile() == nil
+}
+
+// plain tells whether matches of kind need neither rewriting nor filtering
+func (m *Matcher) plain(kind MatchKind) bool {
+	return kind == MatchOverlapping && !m.rewrites() && !m.runeSafe && !m.hasWords
 }
 
-// Match multiple subsequence in seq and return tokens
-func (m *Matcher) Match(seq []byte) *Response {
-	if !m.compiled {
-		m.Compile()
+// MaxLen returns the length of the longest key in compiled matcher
+func (m *Matcher) MaxLen() int {
+	return m.maxLen
+}
+
+// next returns the node reached from nid by label b, following fail links
+func (m *Matcher) next(nid int, b byte) int {
+	da := m.da
+	for {
+		if to, err := da.child(nid, b); err == nil {
+			return to
+		}
+		if nid == 0 {
+			return 0
+		}
+		nid = m.fails[nid]
+	}
+}
+
+// Match multiple subsequence in seq and return tokens,
+// opts bound the matches buffered by the response, see Truncated.
+func (m *Matcher) Match(seq []byte, opts ...MatchOption) *Response {
+	resp, _ := m.MatchContext(context.Background(), seq, opts...)
+	return resp
+}
+
+// ctxStride is the number of bytes matched between checks of a context
+const ctxStride = 4096
+
+// MatchContext is like Match, but stops when ctx is done. The context is
+// checked every few kilobytes, the response then holds the matches found
+// so far and ctx.Err() is returned. The error of Compile is returned with
+// an empty response.
+func (m *Matcher) MatchContext(ctx context.Context, seq []byte, opts ...MatchOption) (*Response, error) {
+	resp := NewResponse(m)
+	for _, opt := range opts {
+		opt(&resp.limits)
+	}
+	if err := m.Compile(); err != nil {
+		return resp, err
+	}
+	done := ctx.Done()
+	if !m.plain(m.kind) {
+		f := m.newFeeder(newWalker(m, m.kind, resp.add), &resp.buf.om)
+		for i, b := range seq {
+			if resp.truncated {
+				return resp, nil
+			}
+			if done != nil && i&(ctxStride-1) == 0 && ctx.Err() != nil {
+				return resp, ctx.Err()
+			}
+			f.feed(b)
+		}
+		f.flush()
+		return resp, nil
 	}
 	nid := 0
 	da := m.da
-	resp := NewResponse(m)
 	for i, b := range seq {
-		for {
-			if da.hasLabel(nid, b) {
-				nid, _ = da.child(nid, b)
-				if da.isEnd(nid) {
-					resp.buf.addAt(matchAt{OutID: nid, At: i})
-				}
+		if done != nil && i&(ctxStride-1) == 0 && ctx.Err() != nil {
+			return resp, ctx.Err()
+		}
+		nid = m.next(nid, b)
+		if nid != 0 && da.isEnd(nid) {
+			resp.add(matchAt{OutID: nid, At: i})
+			if resp.truncated {
 				break
 			}
-			if nid == 0 {
-				break
+		}
+	}
+	return resp, nil
+}
+
+// MatchFunc calls fn for every match in seq without buffering,
+// seq[start:end] is the matched key. It stops as soon as fn returns false.
+// Unlike Match, it allocates nothing per match.
+func (m *Matcher) MatchFunc(seq []byte, fn func(start, end int, value interface{}) bool) {
+	if !m.ready() {
+		return
+	}
+	if !m.plain(m.kind) {
+		m.matchKeys(seq, m.kind, func(start, end, vk int) bool {
+			return fn(start, end, m.da.vals[vk].Value)
+		})
+		return
+	}
+	nid := 0
+	da := m.da
+	for i, b := range seq {
+		nid = m.next(nid, b)
+		if nid == 0 || !da.isEnd(nid) {
+			continue
+		}
+		for e := nid; e > 0; e = m.outLink(e) {
+			vk := m.outputs[e].vKey
+			if vk == 0 {
+				continue
+			}
+			nVal := da.vals[vk]
+			if !fn(i-nVal.Len+1, i+1, nVal.Value) {
+				return
 			}
-			nid = m.fails[nid]
 		}
 	}
-	return resp
+}
+
+// matchKeys calls fn with the value key of every match of kind in seq,
+// until fn returns false. m must be compiled.
+func (m *Matcher) matchKeys(seq []byte, kind MatchKind, fn func(start, end, vk int) bool) {
+	m.matchFragments([][]byte{seq}, kind, fn)
+}
+
+// matchFragments is matchKeys over the concatenation of segs
+func (m *Matcher) matchFragments(segs [][]byte, kind MatchKind, fn func(start, end, vk int) bool) {
+	if m.plain(kind) {
+		nid, i := 0, 0
+		for _, seg := range segs {
+			for _, b := range seg {
+				nid = m.next(nid, b)
+				if nid != 0 && m.da.isEnd(nid) {
+					for e := nid; e > 0; e = m.outLink(e) {
+						if vk := m.outputs[e].vKey; vk != 0 && !fn(i-m.da.vals[vk].Len+1, i+1, vk) {
+							return
+						}
+					}
+				}
+				i++
+			}
+		}
+		return
+	}
+	var om offsetMap
+	stop := false
+	f := m.newFeeder(newWalker(m, kind, func(at matchAt) {
+		stop = stop || !m.eachKey(at, &om, fn)
+	}), &om)
+	for _, seg := range segs {
+		for _, b := range seg {
+			f.feed(b)
+			if stop {
+				return
+			}
+		}
+	}
+	f.flush()
+}
+
+// Truncated tells whether matching stopped at a limit given to Match,
+// matches after the last buffered one are missing.
+func (r *Response) Truncated() bool {
+	return r.truncated
 }
 
 func (r *Response) HasNext() bool {
@@ -180,16 +407,56 @@ func (r *Response) NextMatchItem(content []byte) []MatchToken {
 	if !r.HasNext() {
 		return token
 	}
-	at := r.buf.at[r.buf.nextIdx]
-	for e := &r.ac.outputs[at.OutID]; e != nil; e = e.Link {
-		nVal := r.ac.da.vals[e.vKey]
-		if nVal.Len == 0 {
+	// words ending at the same position are returned together
+	for at := r.buf.at[r.buf.nextIdx].At; r.HasNext() && r.buf.at[r.buf.nextIdx].At == at; r.buf.nextIdx++ {
+		token = r.ac.appendTokens(token, r.buf.at[r.buf.nextIdx], &r.buf.om)
+	}
+	if r.ac.runeSafe {
+		r.buf.rc.fillRunes(content, token)
+	}
+	return token
+}
+
+// appendTokens appends words of at to dst, om maps their
+// positions back to the original input
+func (m *Matcher) appendTokens(dst []MatchToken, at matchAt, om *offsetMap) []MatchToken {
+	if at.VKey != 0 {
+		return append(dst, m.token(at.At, m.da.vals[at.VKey], om))
+	}
+	for e := at.OutID; e > 0; e = m.outLink(e) {
+		if vk := m.outputs[e].vKey; vk != 0 {
+			dst = append(dst, m.token(at.At, m.da.vals[vk], om))
+		}
+	}
+	return dst
+}
+
+// eachKey calls fn with words of at until fn returns false
+func (m *Matcher) eachKey(at matchAt, om *offsetMap, fn func(start, end, vk int) bool) bool {
+	if at.VKey != 0 {
+		t := m.token(at.At, m.da.vals[at.VKey], om)
+		return fn(t.At-t.KLen+1, t.At+1, at.VKey)
+	}
+	for e := at.OutID; e > 0; e = m.outLink(e) {
+		vk := m.outputs[e].vKey
+		if vk == 0 {
 			continue
 		}
-		token = append(token, MatchToken{Value: nVal.Value, At: at.At, KLen: nVal.Len})
+		t := m.token(at.At, m.da.vals[vk], om)
+		if !fn(t.At-t.KLen+1, t.At+1, vk) {
+			return false
+		}
 	}
-	r.buf.nextIdx++
-	return token
+	return true
+}
+
+func (m *Matcher) token(at int, nVal nvalue, om *offsetMap) MatchToken {
+	if len(om.spans) == 0 {
+		return MatchToken{Value: nVal.Value, At: at, KLen: nVal.Len}
+	}
+	start, _ := om.locate(at - nVal.Len + 1)
+	_, end := om.locate(at)
+	return MatchToken{Value: nVal.Value, At: end, KLen: end - start + 1}
 }
 
 // Key extract matched key in seq
@@ -197,42 +464,59 @@ func (m *Matcher) Key(seq []byte, t MatchToken) []byte {
 	return seq[t.At-t.KLen+1 : t.At+1]
 }
 
-func (m *Matcher) addOutput(nid, fid int) {
-	m.outputs[nid].Link = &m.outputs[fid]
+// outLink returns the next node of the output chain of nid, 0 at the end
+func (m *Matcher) outLink(nid int) int {
+	if m.outputs[nid].link {
+		return m.fails[nid]
+	}
+	return 0
 }
 
-func (m *Matcher) buildOutputs() {
+// buildOutputs links outputs in BFS order, so that the end flag
+// of a fail node is settled before its dependents are visited
+func (m *Matcher) buildOutputs(order []int) {
 	da := m.da
-	for nid, fid := range m.fails {
-		if fid == -1 || !da.isEnd(fid) {
+	for _, nid := range order {
+		fid := m.fails[nid]
+		if vk := m.outputs[nid].vKey; vk != 0 {
+			m.longest[nid] = vk
+		} else {
+			m.longest[nid] = m.longest[fid]
+		}
+		if m.reversed {
+			m.first[nid] = da.earlier(m.outputs[nid].vKey, m.first[fid])
+		}
+		if fid == 0 || !da.isEnd(fid) {
 			continue
 		}
 		da.toEnd(nid)
-		m.addOutput(nid, fid)
+		m.outputs[nid].link = true
 	}
 }
 
-func (m *Matcher) buildFails() {
-	q := &list.List{}
+// buildFails returns nodes in BFS order, which is also the queue of
+// nodes to visit
+func (m *Matcher) buildFails() []int {
 	da, ro := m.da, 0
 	m.fails[ro] = ro
-	chds := m.da.childs(ro)
-	for _, c := range chds {
+	order := make([]int, 0, len(da.vals))
+	for _, c := range da.childs(ro) {
 		m.fails[c.ID] = ro
-		q.PushBack(c)
+		m.depth[c.ID] = 1
+		order = append(order, c.ID)
 	}
 	var fid int
-	for q.Len() != 0 {
-		e := q.Front()
-		q.Remove(e)
-		nid := e.Value.(ndesc).ID
+	for i := 0; i < len(order); i++ {
+		nid := order[i]
 		if da.isEnd(nid) {
-			vk, _ := da.vKeyOf(nid)
-			m.outputs[nid].vKey = vk
+			if vk, err := da.vKeyOf(nid); err == nil && da.vals[vk].Len > 0 {
+				m.outputs[nid].vKey = vk
+			}
 		}
 		chds := da.childs(nid)
 		for _, c := range chds {
-			q.PushBack(c)
+			order = append(order, c.ID)
+			m.depth[c.ID] = m.depth[nid] + 1
 			for fid = nid; fid != ro; fid = m.fails[fid] {
 				fs := m.fails[fid]
 				if da.hasLabel(fs, c.Label) {
@@ -243,6 +527,7 @@ func (m *Matcher) buildFails() {
 			m.fails[c.ID] = fid
 		}
 	}
+	return order
 }
 
 func (m *Matcher) dumpDFAFails(out *bytes.Buffer) {
@@ -79,22 +79,39 @@ func (da *Cedar) vKeyOf(id int) (value int, err error) {
 }
 
 // Insert adds a key-value pair into the cedar.
-// It will return ErrInvalidValue, if value < 0 or >= valueLimit.
+// It will return ErrTooLarge, if the key exceeds a limit of the cedar.
 func (da *Cedar) Insert(key []byte, value interface{}) error {
+	if err := da.checkInsert(key); err != nil {
+		return err
+	}
+	da.insert(key, value)
+	return nil
+}
+
+// insert adds a key-value pair and returns its value key
+func (da *Cedar) insert(key []byte, value interface{}) int {
 	k := da.vKey()
 	klen := len(key)
 	p := da.get(key, 0, 0)
 	//fmt.Printf("k:%s, v:%d\n", string(key), value)
+	if old := da.array[p].Value; old != valueLimit {
+		// the key is updated, drop its previous value
+		delete(da.vals, old)
+	}
 	da.array[p].Value = k
 	da.info[p].End = true
-	da.vals[k] = nvalue{Len: klen, Value: value}
-	return nil
+	da.vals[k] = nvalue{Len: klen, Value: value, Seq: da.seq}
+	da.seq++
+	return k
 }
 
 // Update increases the value associated with the `key`.
 // The `key` will be inserted if it is not in the cedar.
 // It will return ErrInvalidValue, if the updated value < 0 or >= valueLimit.
 func (da *Cedar) Update(key []byte, value int) error {
+	if err := da.checkInsert(key); err != nil {
+		return err
+	}
 	id := da.get(key, 0, 0)
 	p := &da.array[id].Value
 	if *p+value < 0 || *p+value >= valueLimit {
@@ -112,6 +129,12 @@ func (da *Cedar) Delete(key []byte) error {
 	if err != nil {
 		return ErrNoPath
 	}
+	// a path without value is a prefix of other keys
+	vk, err := da.vKeyOf(to)
+	if err != nil {
+		return ErrNoPath
+	}
+	delete(da.vals, vk)
 
 	if da.array[to].Value < 0 {
 		base := da.array[to].base()
@@ -125,8 +148,9 @@ func (da *Cedar) Delete(key []byte) error {
 		base := da.array[from].base()
 		label := byte(to ^ base)
 
-		// if `to` has sibling, remove `to` from the sibling list, then stop
-		if da.info[to].Sibling != 0 || da.info[from].Child != label {
+		// if `to` has sibling or is a child of the root, remove `to` from
+		// the sibling list, then stop
+		if da.info[to].Sibling != 0 || da.info[from].Child != label || from == 0 {
 			// delete the label from the child ring first
 			da.popSibling(from, base, label)
 			// then release the current node `to` to the empty node ring
@@ -221,8 +245,9 @@ func (da *Cedar) begin(from int) (to int, err error) {
 		c = da.info[to].Child
 		from = to
 	}
-	if da.array[from].base() > 0 {
-		return da.array[from].base(), nil
+	// the value of a node with children is its child by label 0
+	if base := da.array[from].base(); base > 0 && da.array[base].Check == from {
+		return base, nil
 	}
 	return from, nil
 }
@@ -0,0 +1,119 @@
+package cedar
+
+import (
+	"slices"
+	"sync"
+)
+
+// backward holds the matcher of the reversed keys of a matcher. Walking
+// input backward from a position, its outputs are the keys starting at
+// that position, which leftmost kinds choose from without walking the
+// input again. It is built at Compile for leftmost kinds, and on first
+// use for other kinds, e.g. by a Replacer.
+type backward struct {
+	once sync.Once
+	m    *Matcher
+	// value key and length of the keys, by value key of m
+	keys []backKey
+}
+
+type backKey struct {
+	vk, len int
+}
+
+// resetBackward drops the backward matcher of m
+func (m *Matcher) resetBackward() {
+	m.back = &backward{}
+	if m.leftmost() {
+		m.backward()
+	}
+}
+
+// backward returns the backward matcher of the compiled m, its keys are
+// inserted in the order of the keys of m
+func (m *Matcher) backward() *backward {
+	b := m.back
+	b.once.Do(func() {
+		// key nodes in insertion order
+		type keyNode struct{ seq, nid int }
+		var keys []keyNode
+		da := m.da
+		for nid, out := range m.outputs {
+			if out.vKey != 0 {
+				keys = append(keys, keyNode{da.vals[out.vKey].Seq, nid})
+			}
+		}
+		slices.SortFunc(keys, func(a, b keyNode) int { return a.seq - b.seq })
+		kvs := make([]KeyValue, len(keys))
+		for i, k := range keys {
+			kvs[i] = KeyValue{Key: da.reversedKey(nil, k.nid), Value: m.outputs[k.nid].vKey}
+		}
+		bd, err := BuildCedar(kvs)
+		if err != nil {
+			// keys with a zero byte
+			bd = NewCedar()
+			for _, kv := range kvs {
+				bd.insert(kv.Key, kv.Value)
+			}
+		}
+		b.m = &Matcher{da: bd, reversed: true}
+		b.m.Compile()
+		for bk, v := range bd.vals {
+			b.set(bk, v.Value.(int), v.Len)
+		}
+	})
+	return b
+}
+
+func (b *backward) set(bk, vk, n int) {
+	if bk >= len(b.keys) {
+		b.keys = append(b.keys, make([]backKey, bk+1-len(b.keys))...)
+	}
+	b.keys[bk] = backKey{vk: vk, len: n}
+}
+
+// built returns the backward matcher of m if it was built
+func (m *Matcher) built() *backward {
+	if m.back == nil || m.back.m == nil {
+		return nil
+	}
+	return m.back
+}
+
+// insert adds key of value key vk of m to the backward matcher
+func (b *backward) insert(key []byte, vk int) {
+	b.set(b.m.update(reversed(key), vk), vk, len(key))
+}
+
+// delete removes key of m from the backward matcher
+func (b *backward) delete(key []byte) {
+	b.m.Delete(reversed(key))
+}
+
+// reversedKey appends the key of node id to dst in reverse order
+func (da *Cedar) reversedKey(dst []byte, id int) []byte {
+	for id > 0 {
+		from := da.array[id].Check
+		dst = append(dst, byte(da.array[from].base()^id))
+		id = from
+	}
+	return dst
+}
+
+// reversed returns a reversed copy of key
+func reversed(key []byte) []byte {
+	res := make([]byte, len(key))
+	for i, b := range key {
+		res[len(key)-1-i] = b
+	}
+	return res
+}
+
+// earlier returns the one of value keys a and b inserted first,
+// 0 if both are 0
+func (da *Cedar) earlier(a, b int) int {
+	if a == 0 || b != 0 && da.vals[b].Seq < da.vals[a].Seq {
+		return b
+	}
+	return a
+}
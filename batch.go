@@ -0,0 +1,200 @@
+package cedar
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Document is an input of batch matching, ID identifies its result
+type Document struct {
+	ID   int
+	Data []byte
+}
+
+// DocumentResult holds the matches of a document, Key of each match refers
+// to the document data. Err is set when ctx was done while matching it.
+type DocumentResult struct {
+	ID        int
+	Matches   []Match
+	Truncated bool // see Response.Truncated
+	Err       error
+}
+
+// BatchOption configures batch matching, see MatchStream
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	workers   int
+	completed bool
+	opts      []MatchOption
+}
+
+// WithWorkers sets the number of goroutines matching documents,
+// default is GOMAXPROCS
+func WithWorkers(n int) BatchOption {
+	return func(c *batchConfig) {
+		c.workers = n
+	}
+}
+
+// WithCompletionOrder sends results as soon as documents are matched,
+// instead of in the order of documents
+func WithCompletionOrder() BatchOption {
+	return func(c *batchConfig) {
+		c.completed = true
+	}
+}
+
+// WithDocumentOptions applies opts to the matching of every document
+func WithDocumentOptions(opts ...MatchOption) BatchOption {
+	return func(c *batchConfig) {
+		c.opts = opts
+	}
+}
+
+// batchJob is a document to match, with the channel of its result
+// when results are ordered
+type batchJob struct {
+	doc Document
+	res chan DocumentResult
+}
+
+// MatchStream matches documents received from docs on a pool of goroutines
+// and sends their results on the returned channel, in the order of docs
+// unless WithCompletionOrder is given. Documents are read as results are
+// received, a few per worker in flight. The channel is closed once docs is
+// closed and all results are sent, or as soon as ctx is done: documents
+// left are not matched and results in flight are dropped. Stop receiving
+// results only after ctx is done, otherwise goroutines are leaked.
+func (m *Matcher) MatchStream(ctx context.Context, docs <-chan Document, opts ...BatchOption) <-chan DocumentResult {
+	c := batchConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.workers = max(c.workers, 1)
+	// compile before sharing m between goroutines
+	m.ready()
+
+	out := make(chan DocumentResult)
+	jobs := make(chan batchJob)
+	var order chan chan DocumentResult
+	if !c.completed {
+		order = make(chan chan DocumentResult, c.workers)
+	}
+	go func() {
+		defer close(jobs)
+		if order != nil {
+			defer close(order)
+		}
+		for {
+			var j batchJob
+			select {
+			case doc, ok := <-docs:
+				if !ok {
+					return
+				}
+				j.doc = doc
+			case <-ctx.Done():
+				return
+			}
+			if order != nil {
+				j.res = make(chan DocumentResult, 1)
+				select {
+				case order <- j.res:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := m.matchDocument(ctx, j.doc, c.opts)
+				if j.res != nil {
+					j.res <- res
+					continue
+				}
+				select {
+				case out <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if order == nil {
+		go func() {
+			wg.Wait()
+			close(out)
+		}()
+		return out
+	}
+	go func() {
+		defer close(out)
+		for ch := range order {
+			var res DocumentResult
+			select {
+			case res = <-ch:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// MatchBatch matches docs like MatchStream and returns their results,
+// with ctx.Err() if ctx is done before all documents are matched
+func (m *Matcher) MatchBatch(ctx context.Context, docs []Document, opts ...BatchOption) ([]DocumentResult, error) {
+	in := make(chan Document)
+	go func() {
+		defer close(in)
+		for _, doc := range docs {
+			select {
+			case in <- doc:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	res := make([]DocumentResult, 0, len(docs))
+	for r := range m.MatchStream(ctx, in, opts...) {
+		res = append(res, r)
+	}
+	if len(res) < len(docs) {
+		return res, ctx.Err()
+	}
+	return res, nil
+}
+
+// matchDocument matches doc into a pooled response released once
+// matches are copied
+func (m *Matcher) matchDocument(ctx context.Context, doc Document, opts []MatchOption) DocumentResult {
+	resp, err := m.MatchContext(ctx, doc.Data, opts...)
+	defer resp.Release()
+	res := DocumentResult{ID: doc.ID, Truncated: resp.Truncated(), Err: err}
+	for resp.HasNext() {
+		for _, t := range resp.NextMatchItem(doc.Data) {
+			start, end := t.At-t.KLen+1, t.At+1
+			res.Matches = append(res.Matches, Match{Start: start, End: end, Key: doc.Data[start:end], Value: t.Value})
+		}
+	}
+	return res
+}
@@ -0,0 +1,97 @@
+package cedar
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMatchBatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abcd"[r.Intn(4)]
+		}
+		return b
+	}
+	m := NewMatcher(WithMatchKind(MatchLeftmostLongest))
+	for i := 0; i < 50; i++ {
+		m.Insert(gen(1+r.Intn(4)), i)
+	}
+	m.Insert([]byte("abcd"), -1)
+	docs := make([]Document, 500)
+	for i := range docs {
+		docs[i] = Document{ID: i, Data: gen(r.Intn(200))}
+	}
+	check := func(res []DocumentResult) {
+		if len(res) != len(docs) {
+			t.Fatalf("got %d results", len(res))
+		}
+		for i, dr := range res {
+			var got []string
+			for _, mt := range dr.Matches {
+				got = append(got, fmt.Sprintf("%d-%d:%v", mt.Start, mt.End, mt.Value))
+			}
+			if dr.ID != i || dr.Err != nil || fmt.Sprint(got) != values(m, docs[i].Data) {
+				t.Fatalf("doc %d: got %d %v %v", i, dr.ID, dr.Err, got)
+			}
+		}
+	}
+	res, err := m.MatchBatch(context.Background(), docs, WithWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(res)
+	res, _ = m.MatchBatch(context.Background(), docs, WithWorkers(4), WithCompletionOrder())
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	check(res)
+
+	res, _ = m.MatchBatch(context.Background(), []Document{{Data: []byte("abcdabcd")}}, WithDocumentOptions(WithMaxMatches(1)))
+	if len(res[0].Matches) != 1 || !res[0].Truncated {
+		t.Errorf("got %d matches, truncated %v", len(res[0].Matches), res[0].Truncated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.MatchBatch(ctx, docs); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestMatchStreamBackpressure(t *testing.T) {
+	m := NewMatcher()
+	m.Insert([]byte("he"), 0)
+	for _, opts := range [][]BatchOption{{WithWorkers(3)}, {WithWorkers(3), WithCompletionOrder()}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		docs := make(chan Document)
+		var sent atomic.Int32
+		go func() {
+			defer close(docs)
+			for i := 0; i < 1000; i++ {
+				select {
+				case docs <- Document{ID: i, Data: []byte("ushers")}:
+					sent.Add(1)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		out := m.MatchStream(ctx, docs, opts...)
+		// results are not received, workers and readers block
+		time.Sleep(20 * time.Millisecond)
+		if n := sent.Load(); n > 3+2 {
+			t.Errorf("%d documents read", n)
+		}
+		if res := <-out; res.ID != 0 && len(opts) == 1 {
+			t.Errorf("first result of %d", res.ID)
+		}
+		cancel()
+		for range out {
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package cedar
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// Builder collects keys for an Automaton, it is not safe for concurrent use
+type Builder struct {
+	m *Matcher
+}
+
+// NewBuilder returns a Builder of automatons with the given options
+func NewBuilder(opts ...MatcherOption) *Builder {
+	return &Builder{m: NewMatcher(opts...)}
+}
+
+// Insert adds a key with its value, see Matcher.Insert
+func (b *Builder) Insert(key []byte, value interface{}) error {
+	return b.m.Insert(key, value)
+}
+
+// InsertWord adds a whole word key with its value, see Matcher.InsertWord
+func (b *Builder) InsertWord(key []byte, value interface{}) error {
+	return b.m.InsertWord(key, value)
+}
+
+// Delete removes a key, it will return ErrNoPath if the key has not been added
+func (b *Builder) Delete(key []byte) error {
+	if b.m.rewrites() {
+		key = b.m.foldKey(key)
+	}
+	return b.m.da.Delete(key)
+}
+
+// Build compiles a snapshot of the keys into an Automaton, the Builder
+// can still be updated afterwards. It returns the error of Compile.
+func (b *Builder) Build() (*Automaton, error) {
+	m := *b.m
+	m.da = b.m.da.clone()
+	m.compiled = false
+	if err := m.Compile(); err != nil {
+		return nil, err
+	}
+	return &Automaton{m: &m}, nil
+}
+
+// ReadAutomaton reads a matcher written by WriteTo as an Automaton
+func ReadAutomaton(r io.Reader, opts ...MatcherOption) (*Automaton, error) {
+	m, err := ReadMatcher(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Automaton{m: m}, nil
+}
+
+// Automaton is an immutable compiled matcher made by a Builder,
+// all its methods are safe for concurrent use.
+type Automaton struct {
+	m *Matcher
+}
+
+// Match returns matches in seq, see Matcher.Match
+func (a *Automaton) Match(seq []byte, opts ...MatchOption) *Response {
+	return a.m.Match(seq, opts...)
+}
+
+// MatchContext returns matches in seq until ctx is done, see Matcher.MatchContext
+func (a *Automaton) MatchContext(ctx context.Context, seq []byte, opts ...MatchOption) (*Response, error) {
+	return a.m.MatchContext(ctx, seq, opts...)
+}
+
+// ParallelMatch returns matches in seq using workers goroutines, see Matcher.ParallelMatch
+func (a *Automaton) ParallelMatch(seq []byte, workers int, opts ...MatchOption) *Response {
+	return a.m.ParallelMatch(seq, workers, opts...)
+}
+
+// MatchStream matches documents on a pool of goroutines, see Matcher.MatchStream
+func (a *Automaton) MatchStream(ctx context.Context, docs <-chan Document, opts ...BatchOption) <-chan DocumentResult {
+	return a.m.MatchStream(ctx, docs, opts...)
+}
+
+// MatchBatch matches docs on a pool of goroutines, see Matcher.MatchBatch
+func (a *Automaton) MatchBatch(ctx context.Context, docs []Document, opts ...BatchOption) ([]DocumentResult, error) {
+	return a.m.MatchBatch(ctx, docs, opts...)
+}
+
+// MatchSegments returns matches in fragmented input, see Matcher.MatchSegments
+func (a *Automaton) MatchSegments(segs [][]byte) []SegmentMatch {
+	return a.m.MatchSegments(segs)
+}
+
+// SegmentKey returns the key of mt in segs, see Matcher.SegmentKey
+func (a *Automaton) SegmentKey(segs [][]byte, mt SegmentMatch) []byte {
+	return a.m.SegmentKey(segs, mt)
+}
+
+// MatchFunc calls fn for every match in seq, see Matcher.MatchFunc
+func (a *Automaton) MatchFunc(seq []byte, fn func(start, end int, value interface{}) bool) {
+	a.m.MatchFunc(seq, fn)
+}
+
+// All returns an iterator over matches in seq, see Matcher.All
+func (a *Automaton) All(seq []byte) iter.Seq[Match] {
+	return a.m.All(seq)
+}
+
+// ContainsAny tells whether any key occurs in seq
+func (a *Automaton) ContainsAny(seq []byte) bool {
+	return a.m.ContainsAny(seq)
+}
+
+// FindFirst returns the first match in seq selected by mode
+func (a *Automaton) FindFirst(seq []byte, mode FirstMode) (Match, bool) {
+	return a.m.FindFirst(seq, mode)
+}
+
+// Count returns the number of matches in seq
+func (a *Automaton) Count(seq []byte) int {
+	return a.m.Count(seq)
+}
+
+// NewScanner returns a Scanner of r, see Matcher.NewScanner
+func (a *Automaton) NewScanner(r io.Reader) *Scanner {
+	return a.m.NewScanner(r)
+}
+
+// NewScannerContext returns a Scanner of r until ctx is done, see Matcher.NewScannerContext
+func (a *Automaton) NewScannerContext(ctx context.Context, r io.Reader) *Scanner {
+	return a.m.NewScannerContext(ctx, r)
+}
+
+// Replacer returns a Replacer using values as replacements, see NewReplacer
+func (a *Automaton) Replacer() *Replacer {
+	return NewReplacer(a.m)
+}
+
+// Key returns the matched key of t in seq
+func (a *Automaton) Key(seq []byte, t MatchToken) []byte {
+	return a.m.Key(seq, t)
+}
+
+// MaxLen returns the length of the longest key
+func (a *Automaton) MaxLen() int {
+	return a.m.MaxLen()
+}
+
+// WriteTo writes the automaton to w, ReadMatcher loads it back
+func (a *Automaton) WriteTo(w io.Writer) (int64, error) {
+	return a.m.WriteTo(w)
+}
@@ -0,0 +1,123 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(WithMatchKind(MatchLeftmostLongest), WithFold(FoldASCII))
+	for i, word := range []string{"she", "he", "her", "hers"} {
+		b.Insert([]byte(word), i)
+	}
+	seq := []byte("usHershertongher")
+	a1, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Delete([]byte("HERS")); err != nil {
+		t.Fatal(err)
+	}
+	b.Insert([]byte("tong"), 4)
+	a2, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := func(a *Automaton) string {
+		var res []string
+		for mt := range a.All(seq) {
+			res = append(res, fmt.Sprintf("%s:%v", mt.Key, mt.Value))
+		}
+		return fmt.Sprint(res)
+	}
+	if got, want := all(a1), "[sHe:0 she:0 her:2]"; got != want {
+		t.Errorf("a1 got %s, want %s", got, want)
+	}
+	if got, want := all(a2), "[sHe:0 she:0 tong:4 her:2]"; got != want {
+		t.Errorf("a2 got %s, want %s", got, want)
+	}
+	for a, want := range map[*Automaton]string{a1: "hers", a2: "her"} {
+		if mt, _ := a.FindFirst([]byte("hers"), FirstStart); string(mt.Key) != want {
+			t.Errorf("FindFirst got %s, want %s", mt.Key, want)
+		}
+	}
+	if err := b.Delete([]byte("nothing")); err != ErrNoPath {
+		t.Errorf("got %v, want ErrNoPath", err)
+	}
+	// keys over a limit lowered after insertion fail to compile
+	b.m.da.maxKeys = 1
+	if a, err := b.Build(); a != nil || err != ErrTooLarge {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+// TestAutomatonConcurrent is meant to run with -race
+func TestAutomatonConcurrent(t *testing.T) {
+	b := NewBuilder(WithFold(FoldUnicode), WithRuneSafe())
+	for i, word := range []string{"she", "he", "her", "hers", "中文", "文字"} {
+		b.Insert([]byte(word), i)
+	}
+	a1, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Insert([]byte("tong"), 6)
+	a2, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	automatons := []*Automaton{a1, a2}
+	seq := bytes.Repeat([]byte("ushershertongher 中文字 "), 20)
+
+	want := make([]string, len(automatons))
+	for i, a := range automatons {
+		want[i] = fmt.Sprint(tokens(a, seq))
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				k := (g + i) % len(automatons)
+				a := automatons[k]
+				if got := fmt.Sprint(tokens(a, seq)); got != want[k] {
+					t.Errorf("automaton %d: got %s, want %s", k, got, want[k])
+					return
+				}
+				n := 0
+				a.MatchFunc(seq, func(start, end int, value interface{}) bool {
+					n++
+					return true
+				})
+				if n != a.Count(seq) || !a.ContainsAny(seq) {
+					t.Errorf("automaton %d: MatchFunc, Count or ContainsAny mismatch", k)
+					return
+				}
+				s := a.NewScanner(bytes.NewReader(seq))
+				for s.Scan() {
+				}
+				if a.Replacer().ReplaceString("ushers") == "" {
+					t.Error("empty replacement")
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func tokens(a *Automaton, seq []byte) []string {
+	var res []string
+	resp := a.Match(seq)
+	for resp.HasNext() {
+		for _, itr := range resp.NextMatchItem(seq) {
+			res = append(res, fmt.Sprintf("%s:%d", a.Key(seq, itr), itr.RuneStart))
+		}
+	}
+	resp.Release()
+	return res
+}
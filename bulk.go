@@ -0,0 +1,402 @@
+package cedar
+
+import (
+	"bytes"
+	"math/bits"
+	"slices"
+)
+
+// KeyValue is a key with its value, see BuildCedar
+type KeyValue struct {
+	Key   []byte
+	Value interface{}
+}
+
+// BuildCedar builds a cedar from kvs at once, about 1.5 times faster
+// and in half the memory of inserting keys one by one, see
+// BenchmarkBuildCedar: nodes never move, so that children are placed
+// at the first free nodes of fresh blocks and the cedar is presized.
+// kvs is sorted by key if needed, the order of kvs is kept as the
+// insertion order, and the last value wins for duplicated keys.
+// It returns ErrInvalidKey if a key contains a zero byte, and
+// ErrTooLarge if the keys exceed a limit given by opts.
+func BuildCedar(kvs []KeyValue, opts ...CedarOption) (*Cedar, error) {
+	keys := make([]bulkKey, len(kvs))
+	for i, kv := range kvs {
+		if bytes.IndexByte(kv.Key, 0) >= 0 {
+			return nil, ErrInvalidKey
+		}
+		keys[i] = bulkKey{pre: prefix(kv.Key), i: i, n: len(kv.Key)}
+	}
+	cmp := func(a, b bulkKey) int {
+		if a.pre != b.pre {
+			if a.pre < b.pre {
+				return -1
+			}
+			return 1
+		}
+		if c := bytes.Compare(kvs[a.i].Key, kvs[b.i].Key); c != 0 {
+			return c
+		}
+		return a.i - b.i
+	}
+	if !slices.IsSortedFunc(keys, cmp) {
+		sortKeys(kvs, keys, make([]bulkKey, len(keys)), 0, cmp)
+	}
+	// keep the last of duplicated keys, and count nodes: the root, the
+	// bytes of keys after their common prefix with the previous one, and
+	// one more node for the value of the empty key and keys with children
+	n, nodes := 0, 1
+	for _, k := range keys {
+		lcp := 0
+		if n > 0 {
+			lcp = commonPrefix(kvs, keys[n-1], k)
+			if lcp == keys[n-1].n {
+				if lcp == k.n {
+					n--
+				} else if lcp > 0 {
+					nodes++
+				}
+			}
+		} else if k.n == 0 {
+			nodes++
+		}
+		nodes += k.n - lcp
+		keys[n] = k
+		n++
+	}
+	keys = keys[:n]
+
+	da := NewCedar(opts...)
+	if da.maxKeys > 0 && len(keys) > da.maxKeys {
+		return nil, ErrTooLarge
+	}
+	if da.maxKeyLen > 0 {
+		for _, k := range keys {
+			if k.n > da.maxKeyLen {
+				return nil, ErrTooLarge
+			}
+		}
+	}
+	if da.maxNodes > 0 && nodes > da.maxNodes {
+		return nil, ErrTooLarge
+	}
+	if len(keys) > 0 {
+		// value keys are given in the order of kvs, so that values are
+		// stored in one pass over kvs once the nodes are placed
+		vkeys := make([]int, len(kvs))
+		for _, k := range keys {
+			vkeys[k.i] = -1
+		}
+		for i, k := range vkeys {
+			if k != 0 {
+				da.vkey++
+				vkeys[i] = da.vkey
+			}
+		}
+		// placed children leave a few free nodes at the ends of blocks
+		da.reserve(nodes + nodes/64 + 1024)
+		b := newBulk(da, kvs, vkeys)
+		b.build(keys, 0, 0)
+		b.finish()
+		da.vals = make(map[int]nvalue, len(keys))
+		for i, k := range vkeys {
+			if k != 0 {
+				da.vals[k] = nvalue{Len: len(kvs[i].Key), Value: kvs[i].Value, Seq: i}
+			}
+		}
+	}
+	da.seq = len(kvs)
+	return da, nil
+}
+
+// bulkKey is the key of kvs[i] given to BuildCedar, with its length
+// and first bytes to sort keys without reading them
+type bulkKey struct {
+	pre  uint64
+	i, n int
+}
+
+// prefix returns the first 8 bytes of key as a big endian number
+func prefix(key []byte) uint64 {
+	var p uint64
+	for i := 0; i < 8; i++ {
+		p <<= 8
+		if i < len(key) {
+			p |= uint64(key[i])
+		}
+	}
+	return p
+}
+
+// byteAt returns 1 + the byte of k at depth, 0 past its end
+func (k bulkKey) byteAt(kvs []KeyValue, depth int) int {
+	if depth >= k.n {
+		return 0
+	}
+	if depth < 8 {
+		return int(k.pre>>(56-8*depth)&0xff) + 1
+	}
+	return int(kvs[k.i].Key[depth]) + 1
+}
+
+// sortKeys sorts keys sharing their first depth bytes by a radix sort
+// on the byte at depth, small groups by cmp. tmp holds len(keys) keys.
+func sortKeys(kvs []KeyValue, keys, tmp []bulkKey, depth int, cmp func(a, b bulkKey) int) {
+	if len(keys) <= 64 {
+		slices.SortFunc(keys, cmp)
+		return
+	}
+	// keys ending at depth first, in order as the sort is stable
+	var count [257]int
+	for _, k := range keys {
+		count[k.byteAt(kvs, depth)]++
+	}
+	sum := 0
+	for c, n := range count {
+		count[c] = sum
+		sum += n
+	}
+	for _, k := range keys {
+		c := k.byteAt(kvs, depth)
+		tmp[count[c]] = k
+		count[c]++
+	}
+	copy(keys, tmp)
+	for c, start := 1, count[0]; c < len(count); c++ {
+		if count[c]-start > 1 {
+			sortKeys(kvs, keys[start:count[c]], tmp, depth+1, cmp)
+		}
+		start = count[c]
+	}
+}
+
+// commonPrefix returns the length of the common prefix of keys a and b
+func commonPrefix(kvs []KeyValue, a, b bulkKey) int {
+	if a.pre != b.pre {
+		return min(bits.LeadingZeros64(a.pre^b.pre)/8, a.n, b.n)
+	}
+	x, y := kvs[a.i].Key, kvs[b.i].Key
+	n := min(8, len(x), len(y))
+	for n < len(x) && n < len(y) && x[n] == y[n] {
+		n++
+	}
+	return n
+}
+
+// bulkWindow is the number of last blocks where a bulk build places
+// children, the nodes left free before them stay free
+const bulkWindow = 16
+
+// bulk lays out the nodes of a new cedar. Nodes never move, so that
+// children are placed at the first fitting free nodes of the last
+// blocks instead of searching the block lists of the cedar, which are
+// set once all nodes are placed.
+type bulk struct {
+	da     *Cedar
+	kvs    []KeyValue
+	vkeys  []int
+	labels []byte
+	// free nodes of the window, one bit per node by id modulo the window
+	free  []uint64
+	first int // first block of the window
+	low   int // first word of free which may have a free node
+}
+
+// newBulk returns a bulk layout of da, the root block is left to the
+// children of the root, as in inserts
+func newBulk(da *Cedar, kvs []KeyValue, vkeys []int) *bulk {
+	return &bulk{
+		da: da, kvs: kvs, vkeys: vkeys, labels: make([]byte, 0, 257),
+		free: make([]uint64, bulkWindow*4), first: 1, low: 4,
+	}
+}
+
+func (b *bulk) isFree(e int) bool {
+	return b.free[(e>>6)%len(b.free)]&(1<<(e&63)) != 0
+}
+
+func (b *bulk) take(e int) {
+	b.free[(e>>6)%len(b.free)] &^= 1 << (e & 63)
+}
+
+// addBlock appends a block of free nodes to the window, in place of
+// the first block of a full window
+func (b *bulk) addBlock() {
+	da := b.da
+	if da.size>>8-b.first == bulkWindow {
+		b.first++
+		b.low = max(b.low, b.first*4)
+	}
+	if da.size == da.capacity {
+		da.reserve(da.capacity * 2)
+	}
+	for i := da.size; i < da.size+256; i++ {
+		da.array[i] = node{-1, -1}
+	}
+	for w := da.size >> 6; w < (da.size+256)>>6; w++ {
+		b.free[w%len(b.free)] = ^uint64(0)
+	}
+	da.size += 256
+}
+
+// firstFree returns the first free node of the window
+func (b *bulk) firstFree() int {
+	for ; ; b.low++ {
+		if b.low == b.da.size>>6 {
+			b.addBlock()
+		}
+		if x := b.free[b.low%len(b.free)]; x != 0 {
+			return b.low<<6 + bits.TrailingZeros64(x)
+		}
+	}
+}
+
+// build places the children of from, for sorted keys sharing
+// their first depth bytes, then the subtrees of the children
+func (b *bulk) build(keys []bulkKey, from, depth int) {
+	// a key ending at from is the first one, others are longer
+	own := keys[0].n == depth
+	rest := keys
+	if own {
+		rest = keys[1:]
+	}
+	if own && len(rest) == 0 && from != 0 {
+		b.da.setValue(from, b.vkeys[keys[0].i])
+		return
+	}
+	if !own && len(rest) == 1 && from != 0 {
+		b.chain(rest[0], from, depth)
+		return
+	}
+
+	labels := b.labels[:0]
+	if own {
+		labels = append(labels, 0)
+	}
+	for i, k := range rest {
+		if c := byte(k.byteAt(b.kvs, depth) - 1); i == 0 || c != labels[len(labels)-1] {
+			labels = append(labels, c)
+		}
+	}
+	base := b.place(from, labels)
+
+	if own {
+		b.da.setValue(base, b.vkeys[keys[0].i])
+	}
+	for len(rest) > 0 {
+		c := rest[0].byteAt(b.kvs, depth)
+		i := 1
+		for i < len(rest) && rest[i].byteAt(b.kvs, depth) == c {
+			i++
+		}
+		b.build(rest[:i], base^(c-1), depth+1)
+		rest = rest[i:]
+	}
+}
+
+// chain places the rest of key k from depth as a chain of single children
+func (b *bulk) chain(k bulkKey, from, depth int) {
+	da := b.da
+	da.used += k.n - depth
+	for ; depth < k.n; depth++ {
+		c := k.byteAt(b.kvs, depth) - 1
+		e := b.firstFree()
+		b.take(e)
+		da.array[from].Value = -(e ^ c) - 1
+		da.info[from].Child = byte(c)
+		da.array[e] = node{Value: valueLimit, Check: from}
+		from = e
+	}
+	da.setValue(from, b.vkeys[k.i])
+}
+
+// place takes free nodes for all children labels of from, in order,
+// and returns the base of from
+func (b *bulk) place(from int, labels []byte) int {
+	da := b.da
+	base := -1
+	if from == 0 {
+		base = da.array[0].base()
+	}
+	for w := b.firstFree() >> 6; base < 0; w++ {
+		if w == da.size>>6 {
+			b.addBlock()
+		}
+		for x := b.free[w%len(b.free)]; x != 0 && base < 0; x &= x - 1 {
+			base = (w<<6 + bits.TrailingZeros64(x)) ^ int(labels[0])
+			for _, c := range labels[1:] {
+				if !b.isFree(base ^ int(c)) {
+					base = -1
+					break
+				}
+			}
+		}
+	}
+	da.array[from].Value = -base - 1
+	da.info[from].Child = labels[0]
+	for i, c := range labels {
+		to := base ^ int(c)
+		if from != 0 {
+			b.take(to)
+		}
+		da.array[to] = node{Value: valueLimit, Check: from}
+		da.info[to].Sibling = 0
+		if i < len(labels)-1 {
+			da.info[to].Sibling = labels[i+1]
+		}
+	}
+	da.used += len(labels)
+	return base
+}
+
+// finish links the free nodes of every block and sorts blocks into
+// the lists of full, closed and open blocks, as inserts leave them
+func (b *bulk) finish() {
+	da := b.da
+	da.bheadF, da.bheadC, da.bheadO = 0, 0, 0
+	for bi := 0; bi < da.size>>8; bi++ {
+		blk := &da.blocks[bi]
+		blk.init()
+		blk.Trial = 0
+		first, last, num := -1, -1, 0
+		for e := bi << 8; e < (bi+1)<<8; e++ {
+			if da.array[e].Check >= 0 {
+				continue
+			}
+			if first < 0 {
+				first = e
+			} else {
+				da.array[last].Check = -e
+				da.array[e].Value = -last
+			}
+			last = e
+			num++
+		}
+		if first >= 0 {
+			da.array[last].Check = -first
+			da.array[first].Value = -last
+			blk.Ehead = first
+		}
+		blk.Num = num
+		if bi == 0 {
+			// the root is counted as free
+			blk.Num++
+			continue
+		}
+		switch {
+		case num == 0:
+			da.pushBlock(bi, &da.bheadF, da.bheadF == 0)
+		case num == 1:
+			da.pushBlock(bi, &da.bheadC, da.bheadC == 0)
+		default:
+			da.pushBlock(bi, &da.bheadO, da.bheadO == 0)
+		}
+	}
+}
+
+// setValue sets value key k to node id
+func (da *Cedar) setValue(id, k int) {
+	da.array[id].Value = k
+	da.info[id].End = true
+}
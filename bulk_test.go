@@ -0,0 +1,164 @@
+package cedar
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func listCedar(da *Cedar) []string {
+	var res []string
+	for m := range da.All() {
+		res = append(res, fmt.Sprintf("%s:%v", m.Key, m.Value))
+	}
+	return res
+}
+
+func TestBuildCedar(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abcdef"[r.Intn(6)]
+		}
+		return b
+	}
+	for round, opts := range [][]CedarOption{nil, {WithOrdered(false)}, {WithMaxTrial(4), WithCapacity(1 << 12)}} {
+		kvs := []KeyValue{{Key: []byte{}, Value: -1}}
+		for i := 0; i < 2000; i++ {
+			kvs = append(kvs, KeyValue{Key: gen(r.Intn(8)), Value: i})
+		}
+		da, err := BuildCedar(kvs, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := NewCedar()
+		for _, kv := range kvs {
+			ref.Insert(kv.Key, kv.Value)
+		}
+		got, want := listCedar(da), listCedar(ref)
+		if round == 1 {
+			sort.Strings(got)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("round %d: got %v\nwant %v", round, got, want)
+		}
+
+		// matchers follow the order of kvs
+		m := NewMatcherFromCedar(da, WithMatchKind(MatchLeftmostFirst))
+		mref := NewMatcher(WithMatchKind(MatchLeftmostFirst))
+		for _, kv := range kvs {
+			mref.Insert(kv.Key, kv.Value)
+		}
+		seq := gen(500)
+		if got, want := values(m, seq), values(mref, seq); got != want {
+			t.Fatalf("round %d: got %s\nwant %s", round, got, want)
+		}
+
+		// the cedar can still be updated
+		for i := 0; i < 2000; i++ {
+			key := gen(1 + r.Intn(8))
+			if r.Intn(2) == 0 {
+				da.Insert(key, i)
+				ref.Insert(key, i)
+			} else if _, err := ref.Get(key); err == nil {
+				if err := da.Delete(key); err != nil {
+					t.Fatalf("round %d: Delete %s: %v", round, key, err)
+				}
+				ref.Delete(key)
+			}
+		}
+		got, want = listCedar(da), listCedar(ref)
+		if round == 1 {
+			sort.Strings(got)
+			sort.Strings(want)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("round %d after updates: got %v\nwant %v", round, got, want)
+		}
+	}
+
+	if _, err := BuildCedar([]KeyValue{{Key: []byte("a\x00")}}); err != ErrInvalidKey {
+		t.Errorf("got %v, want ErrInvalidKey", err)
+	}
+	if da, err := BuildCedar(nil); err != nil || len(listCedar(da)) != 0 {
+		t.Errorf("empty build got %v", err)
+	}
+}
+
+// small cedars keep the root block for the children of the root,
+// which later inserts of other nodes must not collide with
+func TestBuildCedarSmall(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func() []byte {
+		b := make([]byte, 1+r.Intn(3))
+		for i := range b {
+			b[i] = "abc"[r.Intn(3)]
+		}
+		return b
+	}
+	for round := 0; round < 2000; round++ {
+		var kvs []KeyValue
+		for i := r.Intn(6); i >= 0; i-- {
+			kvs = append(kvs, KeyValue{Key: gen(), Value: i})
+		}
+		da, err := BuildCedar(kvs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := NewCedar()
+		for _, kv := range kvs {
+			ref.Insert(kv.Key, kv.Value)
+		}
+		for i := 0; i < 10; i++ {
+			key := gen()
+			if r.Intn(2) == 0 {
+				da.Insert(key, i)
+				ref.Insert(key, i)
+			} else if _, err := ref.Get(key); err == nil {
+				if err := da.Delete(key); err != nil {
+					t.Fatalf("round %d: Delete %s: %v", round, key, err)
+				}
+				ref.Delete(key)
+			}
+		}
+		if got, want := listCedar(da), listCedar(ref); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("round %d: got %v\nwant %v", round, got, want)
+		}
+	}
+}
+
+func benchKeyValues() []KeyValue {
+	r := rand.New(rand.NewSource(1))
+	kvs := make([]KeyValue, 200000)
+	for i := range kvs {
+		key := make([]byte, 4+r.Intn(12))
+		for j := range key {
+			key[j] = byte('a' + r.Intn(26))
+		}
+		kvs[i] = KeyValue{Key: key, Value: i}
+	}
+	return kvs
+}
+
+func BenchmarkBuildCedar(b *testing.B) {
+	kvs := benchKeyValues()
+	b.Run("Insert", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			da := NewCedar()
+			for _, kv := range kvs {
+				da.Insert(kv.Key, kv.Value)
+			}
+		}
+	})
+	b.Run("Build", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := BuildCedar(kvs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -2,7 +2,6 @@ package cedar
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io/ioutil"
 )
@@ -23,6 +22,8 @@ type node struct {
 type nvalue struct {
 	Len   int
 	Value interface{}
+	Seq   int  // insertion order
+	Word  bool // whole word key
 }
 
 type ndesc struct {
@@ -54,6 +55,7 @@ type Cedar struct {
 	blocks   []block
 	vals     map[int]nvalue
 	vkey     int
+	seq      int
 	reject   [257]int
 	bheadF   int
 	bheadC   int
@@ -62,10 +64,45 @@ type Cedar struct {
 	size     int
 	ordered  bool
 	maxTrial int
+	used     int // nodes in use
+	limits
+	// moved is called when a node is relocated by an insertion
+	moved func(from, to int)
+}
+
+// CedarOption configures a Cedar
+type CedarOption func(*Cedar)
+
+// WithCapacity presizes the cedar for n nodes, about the total length
+// of keys not shared by prefixes, to avoid growing it on inserts.
+func WithCapacity(n int) CedarOption {
+	return func(da *Cedar) {
+		da.reserve(n)
+	}
+}
+
+// WithOrdered sets whether children are kept sorted by label, which is
+// the default. Unordered children make inserts faster, but keys are
+// no longer visited in order.
+func WithOrdered(ordered bool) CedarOption {
+	return func(da *Cedar) {
+		da.ordered = ordered
+	}
+}
+
+// WithMaxTrial sets how many times a block may fail to place children
+// before it is skipped, the default is 1. Larger values make the
+// cedar more compact and inserts slower.
+func WithMaxTrial(n int) CedarOption {
+	return func(da *Cedar) {
+		if n > 0 {
+			da.maxTrial = n
+		}
+	}
 }
 
 // NewCedar new a Cedar instance
-func NewCedar() *Cedar {
+func NewCedar(opts ...CedarOption) *Cedar {
 	da := Cedar{
 		array:    make([]node, 256),
 		info:     make([]ninfo, 256),
@@ -76,6 +113,7 @@ func NewCedar() *Cedar {
 		vkey:     1,
 		ordered:  true,
 		maxTrial: 1,
+		used:     1,
 	}
 
 	da.array[0] = node{-2, 0}
@@ -92,14 +130,32 @@ func NewCedar() *Cedar {
 		da.reject[i] = i + 1
 	}
 
+	for _, opt := range opts {
+		opt(&da)
+	}
 	return &da
 }
 
+// clone returns a deep copy of the cedar
+func (da *Cedar) clone() *Cedar {
+	c := *da
+	c.array = append([]node(nil), da.array...)
+	c.info = append([]ninfo(nil), da.info...)
+	c.blocks = append([]block(nil), da.blocks...)
+	c.moved = nil
+	c.vals = make(map[int]nvalue, len(da.vals))
+	for k, v := range da.vals {
+		c.vals[k] = v
+	}
+	return &c
+}
+
 func (da *Cedar) vKey() int {
 	k := da.vkey
 	for {
 		k = (k + 1) % da.capacity
-		if _, ok := da.vals[k]; !ok {
+		// 0 is reserved for nodes without value
+		if _, ok := da.vals[k]; !ok && k != 0 {
 			break
 		}
 	}
@@ -167,21 +223,35 @@ func (da *Cedar) pushBlock(bi int, headOut *int, empty bool) {
 	}
 }
 
-func (da *Cedar) addBlock() int {
-	if da.size == da.capacity {
-		da.capacity *= 2
+// reserve grows the capacity to at least n nodes
+func (da *Cedar) reserve(n int) {
+	n = (n + 255) &^ 255
+	if n <= da.capacity {
+		return
+	}
+	da.capacity = n
 
-		oldarray := da.array
-		da.array = make([]node, da.capacity)
-		copy(da.array, oldarray)
+	oldarray := da.array
+	da.array = make([]node, da.capacity)
+	copy(da.array, oldarray)
 
-		oldNinfo := da.info
-		da.info = make([]ninfo, da.capacity)
-		copy(da.info, oldNinfo)
+	oldNinfo := da.info
+	da.info = make([]ninfo, da.capacity)
+	copy(da.info, oldNinfo)
 
-		oldBlock := da.blocks
-		da.blocks = make([]block, da.capacity>>8)
-		copy(da.blocks, oldBlock)
+	oldBlock := da.blocks
+	da.blocks = make([]block, da.capacity>>8)
+	copy(da.blocks, oldBlock)
+}
+
+func (da *Cedar) addBlock() int {
+	if da.size == da.capacity {
+		n := da.capacity * 2
+		// grow up to the node limit, then block by block
+		if da.maxNodes > 0 && n > da.maxNodes {
+			n = max(da.maxNodes, da.size+256)
+		}
+		da.reserve(n)
 	}
 
 	da.blocks[da.size>>8].init()
@@ -228,6 +298,7 @@ func (da *Cedar) popEnode(base int, label byte, from int) int {
 	}
 	n.Value = valueLimit
 	n.Check = from
+	da.used++
 	if base < 0 {
 		da.array[from].Value = -(e ^ int(label)) - 1
 	}
@@ -235,6 +306,7 @@ func (da *Cedar) popEnode(base int, label byte, from int) int {
 }
 
 func (da *Cedar) pushEnode(e int) {
+	da.used--
 	bi := e >> 8
 	b := &da.blocks[bi]
 	b.Num++
@@ -307,7 +379,7 @@ func (da *Cedar) child(id int, label byte) (int, error) {
 	base := da.array[id].base()
 	cid := base ^ int(label)
 	if cid < 0 || cid >= da.size || da.array[cid].Check != id {
-		return -1, errors.New("cann't find child in node")
+		return -1, ErrNoPath
 	}
 	return cid, nil
 }
@@ -459,6 +531,9 @@ func (da *Cedar) resolve(fromN, baseN int, labelN byte) int {
 				c = da.info[n.base()^int(c)].Sibling
 			}
 		}
+		if da.moved != nil && children[i] != 0 {
+			da.moved(newto, to)
+		}
 		if !flag && newto == fromN { // parent node moved
 			fromN = to
 		}
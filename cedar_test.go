@@ -41,3 +41,39 @@ func TestInsertFloat(t *testing.T) {
 	}
 	cd.DumpGraph("datrie.gv")
 }
+
+func TestIterators(t *testing.T) {
+	cd := NewCedar()
+	words := []string{
+		"she", "hers", "her", "he", "abc",
+	}
+	for i, word := range words {
+		cd.Insert([]byte(word), i)
+	}
+	var got []string
+	for m := range cd.All() {
+		got = append(got, fmt.Sprintf("%s:%d", m.Key, m.Value.(int)))
+	}
+	if want := "[abc:4 he:3 her:2 hers:1 she:0]"; fmt.Sprint(got) != want {
+		t.Errorf("All got %v, want %s", got, want)
+	}
+
+	got = got[:0]
+	for m := range cd.PrefixPredictSeq([]byte("he")) {
+		got = append(got, string(m.Key))
+		if len(got) == 2 {
+			break
+		}
+	}
+	if want := "[he her]"; fmt.Sprint(got) != want {
+		t.Errorf("PrefixPredictSeq got %v, want %s", got, want)
+	}
+
+	got = got[:0]
+	for m := range cd.PrefixMatchSeq([]byte("hersx")) {
+		got = append(got, fmt.Sprintf("%d-%d:%s", m.Start, m.End, m.Key))
+	}
+	if want := "[0-2:he 0-3:her 0-4:hers]"; fmt.Sprint(got) != want {
+		t.Errorf("PrefixMatchSeq got %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package cedar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+// countCtx is canceled after n checks
+type countCtx struct {
+	context.Context
+	n int
+}
+
+func (c *countCtx) Done() <-chan struct{} {
+	return make(chan struct{})
+}
+
+func (c *countCtx) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestMatchContext(t *testing.T) {
+	seq := bytes.Repeat([]byte("hers "), 4*ctxStride)
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostLongest} {
+		m := NewMatcher(WithMatchKind(kind))
+		for i, key := range []string{"he", "her", "hers"} {
+			m.Insert([]byte(key), i)
+		}
+		all := spans(m, seq)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		resp, err := m.MatchContext(ctx, seq)
+		if err != context.Canceled || resp.HasNext() {
+			t.Errorf("kind %d: got %v", kind, err)
+		}
+		resp.Release()
+
+		resp, err = m.MatchContext(&countCtx{Context: context.Background(), n: 2}, seq)
+		var got []string
+		for resp.HasNext() {
+			for _, tk := range resp.NextMatchItem(seq) {
+				got = append(got, fmt.Sprintf("%d-%d", tk.At-tk.KLen+1, tk.At))
+			}
+		}
+		resp.Release()
+		if err != context.Canceled || len(got) == 0 || len(got) >= len(all) || fmt.Sprint(got) != fmt.Sprint(all[:len(got)]) {
+			t.Errorf("kind %d: got %d matches, %v", kind, len(got), err)
+		}
+
+		s := m.NewScannerContext(&countCtx{Context: context.Background(), n: 2}, bytes.NewReader(seq))
+		n := 0
+		for s.Scan() {
+			n++
+		}
+		if s.Err() != context.Canceled || n == 0 || s.Offset() >= len(seq) {
+			t.Errorf("kind %d: scanned %d positions, %v", kind, n, s.Err())
+		}
+	}
+}
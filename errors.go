@@ -9,5 +9,10 @@ var (
 	ErrInvalidKey      = errors.New("cedar: invalid key")
 	ErrNoPath          = errors.New("cedar: no path")
 	ErrNoValue         = errors.New("cedar: no value")
-	ErrTooLarge        = errors.New("acmatcher: Tool Large for grow")
+	ErrInvalidFormat   = errors.New("cedar: invalid format")
+	ErrVersion         = errors.New("cedar: unsupported format version")
+	ErrChecksum        = errors.New("cedar: checksum mismatch")
+	ErrUnsupported     = errors.New("cedar: unsupported matcher options")
+	ErrTooLarge        = errors.New("cedar: too large")
+	ErrClosed          = errors.New("cedar: write after close")
 )
@@ -0,0 +1,71 @@
+package cedar
+
+// FirstMode selects which match FindFirst returns
+type FirstMode int
+
+const (
+	// FirstEnd returns the match ending first, the longest one if several
+	// keys end at the same position
+	FirstEnd FirstMode = iota
+	// FirstStart returns the leftmost match, ties are broken as in
+	// MatchLeftmostFirst if the Matcher uses it, else as in MatchLeftmostLongest
+	FirstStart
+)
+
+// ContainsAny tells whether any key occurs in seq,
+// it returns as soon as the first match is found.
+func (m *Matcher) ContainsAny(seq []byte) bool {
+	if !m.ready() {
+		return false
+	}
+	if m.plain(MatchOverlapping) {
+		nid := 0
+		for _, b := range seq {
+			nid = m.next(nid, b)
+			if m.longest[nid] != 0 {
+				return true
+			}
+		}
+		return false
+	}
+	found := false
+	m.matchKeys(seq, MatchOverlapping, func(start, end, vk int) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// FindFirst returns the first match in seq selected by mode,
+// it stops scanning as soon as the match is settled.
+func (m *Matcher) FindFirst(seq []byte, mode FirstMode) (Match, bool) {
+	if !m.ready() {
+		return Match{}, false
+	}
+	kind := MatchLongestPerEnd
+	if mode == FirstStart {
+		kind = MatchLeftmostLongest
+		if m.kind == MatchLeftmostFirst {
+			kind = MatchLeftmostFirst
+		}
+	}
+	var mt Match
+	found := false
+	m.matchKeys(seq, kind, func(start, end, vk int) bool {
+		mt = Match{Start: start, End: end, Key: seq[start:end], Value: m.da.vals[vk].Value}
+		found = true
+		return false
+	})
+	return mt, found
+}
+
+// Count returns the number of matches in seq with the MatchKind of m,
+// without buffering them.
+func (m *Matcher) Count(seq []byte) int {
+	n := 0
+	m.MatchFunc(seq, func(start, end int, value interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,102 @@
+package cedar
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	m := NewMatcher()
+	for i, word := range []string{"she", "he", "her", "hers", "tong"} {
+		m.Insert([]byte(word), i)
+	}
+	seq := []byte("ushershertongher")
+	if !m.ContainsAny(seq) || m.ContainsAny([]byte("xyz")) {
+		t.Error("ContainsAny")
+	}
+	if got := m.Count(seq); got != 10 {
+		t.Errorf("Count got %d, want 10", got)
+	}
+	cases := []struct {
+		mode FirstMode
+		seq  []byte
+		want string
+	}{
+		{FirstEnd, seq[2:], "0-2:he:1"},
+		{FirstStart, seq[2:], "0-4:hers:3"},
+		{FirstEnd, seq, "1-4:she:0"},
+		{FirstStart, seq, "1-4:she:0"},
+	}
+	for _, c := range cases {
+		mt, ok := m.FindFirst(c.seq, c.mode)
+		if !ok {
+			t.Fatalf("mode %d in %s: no match", c.mode, c.seq)
+		}
+		if got := fmt.Sprintf("%d-%d:%s:%d", mt.Start, mt.End, mt.Key, mt.Value.(int)); got != c.want {
+			t.Errorf("mode %d in %s: got %s, want %s", c.mode, c.seq, got, c.want)
+		}
+	}
+	if _, ok := m.FindFirst([]byte("xyz"), FirstStart); ok {
+		t.Error("FindFirst found a match in xyz")
+	}
+
+	w := NewMatcher(WithWholeWords())
+	w.Insert([]byte("he"), 0)
+	if w.ContainsAny([]byte("she hers")) || !w.ContainsAny([]byte("she he")) {
+		t.Error("ContainsAny with whole words")
+	}
+	if mt, _ := w.FindFirst([]byte("she he"), FirstEnd); mt.Start != 4 {
+		t.Errorf("FindFirst with whole words got %d, want 4", mt.Start)
+	}
+}
+
+func TestFindRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[r.Intn(3)]
+		}
+		return b
+	}
+	for round := 0; round < 200; round++ {
+		var words []string
+		seen := map[string]bool{}
+		for len(words) < 4 {
+			w := string(gen(1 + r.Intn(4)))
+			if !seen[w] {
+				seen[w] = true
+				words = append(words, w)
+			}
+		}
+		seq := gen(20)
+		for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostFirst, MatchLeftmostLongest} {
+			m := NewMatcher(WithMatchKind(kind))
+			for i, w := range words {
+				m.Insert([]byte(w), i)
+			}
+			all := naiveMatch(words, kind, seq)
+			if got := m.Count(seq); got != len(all) {
+				t.Fatalf("kind %d words %q seq %s: Count got %d, want %d", kind, words, seq, got, len(all))
+			}
+			if got := m.ContainsAny(seq); got != (len(all) > 0) {
+				t.Fatalf("words %q seq %s: ContainsAny got %v", words, seq, got)
+			}
+			firsts := map[FirstMode]MatchKind{FirstEnd: MatchLongestPerEnd, FirstStart: MatchLeftmostLongest}
+			if kind == MatchLeftmostFirst {
+				firsts[FirstStart] = MatchLeftmostFirst
+			}
+			for mode, k := range firsts {
+				want := naiveMatch(words, k, seq)
+				mt, ok := m.FindFirst(seq, mode)
+				if ok != (len(want) > 0) {
+					t.Fatalf("words %q seq %s mode %d: found %v", words, seq, mode, ok)
+				}
+				if got := fmt.Sprintf("%d-%d", mt.Start, mt.End-1); ok && got != want[0] {
+					t.Fatalf("words %q seq %s mode %d: got %s, want %s", words, seq, mode, got, want[0])
+				}
+			}
+		}
+	}
+}
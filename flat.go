@@ -0,0 +1,350 @@
+package cedar
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// flat layout, all integers are little endian int32:
+//
+//	header:	magic, version, nodes, values, maxLen, blob size
+//	nodes:	base, check, fail, output value, next output node
+//	values:	key length, blob offset, blob length
+//	blob:	values encoded by the codec
+const (
+	flatHeaderSize = 24
+	flatNodeSize   = 20
+	flatValueSize  = 12
+)
+
+var flatMagic = [4]byte{'A', 'C', 'F', 'L'}
+
+// BytesCodec keeps string and []byte values as they are, any other value
+// fails to encode. Values are decoded as []byte sharing the input, which
+// makes it the codec of choice for FlatMatcher.
+var BytesCodec ValueCodec = bytesCodec{}
+
+type bytesCodec struct{}
+
+func (bytesCodec) EncodeValue(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, nil
+	}
+	return nil, ErrInvalidValue
+}
+
+func (bytesCodec) DecodeValue(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// WriteFlat compiles m if needed and writes it to w in a flat, pointer
+// free layout, which FlatMatcher matches against without decoding.
+// Values are encoded by codec, BytesCodec if nil. Only MatchOverlapping
+// matchers without rewriting, rune safety and whole word keys can be
+// written, it returns ErrUnsupported for others.
+func (m *Matcher) WriteFlat(w io.Writer, codec ValueCodec) error {
+	if err := m.Compile(); err != nil {
+		return err
+	}
+	if !m.plain(MatchOverlapping) || m.kind != MatchOverlapping {
+		return ErrUnsupported
+	}
+	if codec == nil {
+		codec = BytesCodec
+	}
+	da := m.da
+	slots := make(map[int]int, len(da.vals))
+	var vals, blob []byte
+	for nid := 0; nid < da.size; nid++ {
+		vk := m.outputs[nid].vKey
+		if _, ok := slots[vk]; vk == 0 || ok {
+			continue
+		}
+		data, err := codec.EncodeValue(da.vals[vk].Value)
+		if err != nil {
+			return err
+		}
+		slots[vk] = len(vals) / flatValueSize
+		vals = appendInt32(vals, da.vals[vk].Len, len(blob), len(data))
+		blob = append(blob, data...)
+	}
+	if da.size > math.MaxInt32/flatNodeSize || len(blob) > math.MaxInt32 {
+		return ErrTooLarge
+	}
+	head := append(flatMagic[:], make([]byte, flatHeaderSize-4)...)
+	binary.LittleEndian.PutUint32(head[4:], formatVersion)
+	binary.LittleEndian.PutUint32(head[8:], uint32(da.size))
+	binary.LittleEndian.PutUint32(head[12:], uint32(len(slots)))
+	binary.LittleEndian.PutUint32(head[16:], uint32(m.maxLen))
+	binary.LittleEndian.PutUint32(head[20:], uint32(len(blob)))
+	nodes := make([]byte, 0, da.size*flatNodeSize)
+	for nid := 0; nid < da.size; nid++ {
+		out, next := -1, -1
+		if vk := m.outputs[nid].vKey; vk != 0 {
+			out = slots[vk]
+		}
+		if m.outputs[nid].link {
+			next = m.fails[nid]
+		}
+		nodes = appendInt32(nodes, da.array[nid].base(), da.array[nid].Check, m.fails[nid], out, next)
+	}
+	for _, p := range [][]byte{head, nodes, vals, blob} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendInt32(dst []byte, vs ...int) []byte {
+	for _, v := range vs {
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(int32(v)))
+	}
+	return dst
+}
+
+// FlatMatcher matches against a matcher written by WriteFlat in place,
+// e.g. in a memory mapped file shared by processes. It reports
+// overlapping matches like MatchFunc of Matcher, values are the encoded
+// bytes of the flat data. It is safe for concurrent use.
+type FlatMatcher struct {
+	nodes, vals, blob []byte
+	size, maxLen      int
+	closer            func() error
+}
+
+// NewFlatMatcher returns a FlatMatcher over data written by WriteFlat,
+// data is used in place and must not be modified. Only the header is
+// checked, so that opening takes constant time and leaves pages unread:
+// matching corrupted data never panics nor loops, but reports wrong
+// matches, call Verify for data from untrusted sources.
+func NewFlatMatcher(data []byte) (*FlatMatcher, error) {
+	if len(data) < flatHeaderSize || string(data[:4]) != string(flatMagic[:]) {
+		return nil, ErrInvalidFormat
+	}
+	if binary.LittleEndian.Uint32(data[4:]) != formatVersion {
+		return nil, ErrVersion
+	}
+	size := int(binary.LittleEndian.Uint32(data[8:]))
+	nVals := int(binary.LittleEndian.Uint32(data[12:]))
+	maxLen := int(binary.LittleEndian.Uint32(data[16:]))
+	nBlob := int(binary.LittleEndian.Uint32(data[20:]))
+	rest := data[flatHeaderSize:]
+	// keys of maxLen bytes take more nodes, which bounds walks
+	if size == 0 || size > len(rest)/flatNodeSize || maxLen >= size {
+		return nil, ErrInvalidFormat
+	}
+	fm := &FlatMatcher{size: size, maxLen: maxLen}
+	fm.nodes, rest = rest[:size*flatNodeSize], rest[size*flatNodeSize:]
+	if nVals > len(rest)/flatValueSize {
+		return nil, ErrInvalidFormat
+	}
+	fm.vals, rest = rest[:nVals*flatValueSize], rest[nVals*flatValueSize:]
+	if nBlob != len(rest) {
+		return nil, ErrInvalidFormat
+	}
+	fm.blob = rest
+	return fm, nil
+}
+
+// Verify checks every node and value of fm once, in time and memory
+// linear in its size, and returns ErrInvalidFormat if fm is corrupted.
+func (fm *FlatMatcher) Verify() error {
+	if !fm.valid() {
+		return ErrInvalidFormat
+	}
+	return nil
+}
+
+// valid checks the links of nodes and the slots of values. Fail links
+// and output links lead to shallower nodes, so that walks end, and the
+// key of an output is as long as its node is deep.
+func (fm *FlatMatcher) valid() bool {
+	depth, ok := fm.depths()
+	if !ok {
+		return false
+	}
+	nVals := len(fm.vals) / flatValueSize
+	for nid := 1; nid < fm.size; nid++ {
+		d := depth[nid]
+		if d < 0 {
+			// a free node, never reached by next
+			continue
+		}
+		if f := fm.field(nid, 2); f < 0 || f >= fm.size || depth[f] < 0 || depth[f] >= d {
+			return false
+		}
+		if out := fm.field(nid, 3); out >= nVals || out >= 0 && fm.slotLen(out) != d {
+			return false
+		}
+		if e := fm.field(nid, 4); e >= fm.size || e > 0 && (depth[e] < 0 || depth[e] >= d) {
+			return false
+		}
+	}
+	for i := 0; i < nVals; i++ {
+		p := fm.vals[i*flatValueSize:]
+		off := int(binary.LittleEndian.Uint32(p[4:]))
+		if n := int(binary.LittleEndian.Uint32(p[8:])); off+n > len(fm.blob) {
+			return false
+		}
+	}
+	return true
+}
+
+// depths returns the depth of nodes following check links up to the
+// root, -1 for free nodes and value nodes, and false if check links loop
+func (fm *FlatMatcher) depths() ([]int, bool) {
+	const unknown, walking = -2, -3
+	depth := make([]int, fm.size)
+	for i := range depth {
+		depth[i] = unknown
+	}
+	depth[0] = 0
+	var path []int
+	for nid := range depth {
+		p := nid
+		for depth[p] == unknown {
+			c := fm.field(p, 1)
+			if c < 0 || c >= fm.size || fm.field(c, 0)^p == 0 {
+				depth[p] = -1
+				break
+			}
+			depth[p] = walking
+			path = append(path, p)
+			p = c
+		}
+		if depth[p] == walking {
+			return nil, false
+		}
+		for j := len(path) - 1; j >= 0; j-- {
+			if depth[p] < 0 {
+				depth[path[j]] = -1
+			} else {
+				depth[path[j]] = depth[p] + 1
+			}
+			p = path[j]
+		}
+		path = path[:0]
+	}
+	return depth, true
+}
+
+// slotLen returns the key length of value slot i
+func (fm *FlatMatcher) slotLen(i int) int {
+	return int(binary.LittleEndian.Uint32(fm.vals[i*flatValueSize:]))
+}
+
+// OpenFlat memory maps a file written by WriteFlat, where supported,
+// and returns a FlatMatcher over it. Close releases the mapping.
+func OpenFlat(name string) (*FlatMatcher, error) {
+	data, closer, err := mapFile(name)
+	if err != nil {
+		return nil, err
+	}
+	fm, err := NewFlatMatcher(data)
+	if err != nil {
+		closer()
+		return nil, err
+	}
+	fm.closer = closer
+	return fm, nil
+}
+
+// Close releases the file opened by OpenFlat,
+// fm must not be used afterwards.
+func (fm *FlatMatcher) Close() error {
+	if fm.closer == nil {
+		return nil
+	}
+	err := fm.closer()
+	fm.closer, fm.nodes, fm.vals, fm.blob = nil, nil, nil, nil
+	return err
+}
+
+// MaxLen returns the length of the longest key
+func (fm *FlatMatcher) MaxLen() int {
+	return fm.maxLen
+}
+
+func (fm *FlatMatcher) field(nid, i int) int {
+	return int(int32(binary.LittleEndian.Uint32(fm.nodes[nid*flatNodeSize+i*4:])))
+}
+
+// next returns the node reached from nid by label b, following fail links.
+// Label 0 leads to value nodes, keys have no zero byte. Fail links lead
+// to shallower nodes, so that at most maxLen of them are followed.
+func (fm *FlatMatcher) next(nid int, b byte) int {
+	for n := 0; n <= fm.maxLen; n++ {
+		cid := fm.field(nid, 0) ^ int(b)
+		if b != 0 && cid >= 0 && cid < fm.size && fm.field(cid, 1) == nid {
+			return cid
+		}
+		if nid == 0 {
+			return 0
+		}
+		if nid = fm.field(nid, 2); nid < 0 || nid >= fm.size {
+			return 0
+		}
+	}
+	return 0
+}
+
+// value returns the key length and encoded value of slot i,
+// false if the slot is out of the data
+func (fm *FlatMatcher) value(i int) (int, []byte, bool) {
+	if i < 0 || i >= len(fm.vals)/flatValueSize {
+		return 0, nil, false
+	}
+	p := fm.vals[i*flatValueSize:]
+	klen := fm.slotLen(i)
+	off := int(binary.LittleEndian.Uint32(p[4:]))
+	n := int(binary.LittleEndian.Uint32(p[8:]))
+	if off > len(fm.blob) || n > len(fm.blob)-off {
+		return 0, nil, false
+	}
+	return klen, fm.blob[off : off+n : off+n], true
+}
+
+// MatchFunc calls fn for every match in seq, seq[start:end] is the
+// matched key. It stops as soon as fn returns false.
+func (fm *FlatMatcher) MatchFunc(seq []byte, fn func(start, end int, value []byte) bool) {
+	nid := 0
+	for i, b := range seq {
+		nid = fm.next(nid, b)
+		// output links lead to shallower nodes, as many as maxLen
+		for e, n := nid, 0; e > 0 && e < fm.size && n < fm.maxLen; e, n = fm.field(e, 4), n+1 {
+			if out := fm.field(e, 3); out >= 0 {
+				klen, v, ok := fm.value(out)
+				if ok && klen > 0 && klen <= i+1 && !fn(i-klen+1, i+1, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ContainsAny tells whether any key occurs in seq
+func (fm *FlatMatcher) ContainsAny(seq []byte) bool {
+	found := false
+	fm.MatchFunc(seq, func(start, end int, value []byte) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// Count returns the number of matches in seq
+func (fm *FlatMatcher) Count(seq []byte) int {
+	n := 0
+	fm.MatchFunc(seq, func(start, end int, value []byte) bool {
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,177 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func flatSpans(fm *FlatMatcher, seq []byte) []string {
+	var res []string
+	fm.MatchFunc(seq, func(start, end int, value []byte) bool {
+		res = append(res, fmt.Sprintf("%d-%d:%s", start, end-1, value))
+		return true
+	})
+	return res
+}
+
+func TestFlatMatcher(t *testing.T) {
+	m := NewMatcher()
+	words := []string{"she", "he", "her", "hers", "中文", "文"}
+	for _, word := range words {
+		m.Insert([]byte(word), "v"+word)
+	}
+	fname := filepath.Join(t.TempDir(), "dict.flat")
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WriteFlat(f, nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fm, err := OpenFlat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+	seq := []byte("ushershertongher 中文")
+	var want []string
+	m.MatchFunc(seq, func(start, end int, value interface{}) bool {
+		want = append(want, fmt.Sprintf("%d-%d:%s", start, end-1, value))
+		return true
+	})
+	if got := flatSpans(fm, seq); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !fm.ContainsAny(seq) || fm.Count(seq) != len(want) || fm.MaxLen() != m.MaxLen() {
+		t.Error("ContainsAny, Count or MaxLen mismatch")
+	}
+
+	for _, opt := range []MatcherOption{WithWholeWords(), WithMatchKind(MatchLeftmostLongest)} {
+		w := NewMatcher(opt)
+		w.Insert([]byte("he"), "he")
+		if err := w.WriteFlat(&bytes.Buffer{}, nil); err != ErrUnsupported {
+			t.Errorf("got %v, want ErrUnsupported", err)
+		}
+	}
+	m.Insert([]byte("int"), 1)
+	if err := NewMatcherFromCedar(m.Cedar()).WriteFlat(&bytes.Buffer{}, nil); err != ErrInvalidValue {
+		t.Errorf("got %v, want ErrInvalidValue", err)
+	}
+	if _, err := NewFlatMatcher([]byte("ACFL")); err != ErrInvalidFormat {
+		t.Errorf("got %v, want ErrInvalidFormat", err)
+	}
+}
+
+func TestFlatMatcherRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[r.Intn(3)]
+		}
+		return b
+	}
+	for round := 0; round < 100; round++ {
+		m := NewMatcher()
+		for i := 0; i < 8; i++ {
+			w := gen(1 + r.Intn(5))
+			m.Insert(w, string(w))
+		}
+		var buf bytes.Buffer
+		if err := m.WriteFlat(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		fm, err := NewFlatMatcher(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq := gen(50)
+		var want []string
+		m.MatchFunc(seq, func(start, end int, value interface{}) bool {
+			want = append(want, fmt.Sprintf("%d-%d:%s", start, end-1, value))
+			return true
+		})
+		if got := flatSpans(fm, seq); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("seq %q: got %v, want %v", seq, got, want)
+		}
+	}
+}
+
+func TestFlatMatcherCorrupted(t *testing.T) {
+	m := NewMatcher()
+	for _, word := range []string{"she", "he", "her", "hers", "ab", "abc"} {
+		m.Insert([]byte(word), "v"+word)
+	}
+	var buf bytes.Buffer
+	if err := m.WriteFlat(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	size := m.da.size
+	nodeAt := func(nid, i int) int { return flatHeaderSize + nid*flatNodeSize + i*4 }
+	valAt := func(slot, i int) int { return flatHeaderSize + size*flatNodeSize + slot*flatValueSize + i*4 }
+	hers := m.path([]byte("hers"))
+	put := func(p []byte, off, v int) { binary.LittleEndian.PutUint32(p[off:], uint32(int32(v))) }
+	cases := []struct {
+		name string
+		off  int
+		v    int
+	}{
+		{"fail out of range", nodeAt(hers[3], 2), size},
+		{"fail to itself", nodeAt(hers[3], 2), hers[3]},
+		{"fail to a deeper node", nodeAt(hers[1], 2), hers[3]},
+		{"output out of range", nodeAt(hers[3], 3), 100},
+		{"output link loop", nodeAt(hers[3], 4), hers[3]},
+		{"check loop", nodeAt(hers[0], 1), hers[2]},
+		{"key length", valAt(0, 0), 100},
+		{"value offset", valAt(0, 1), len(data)},
+	}
+	for _, c := range cases {
+		p := append([]byte(nil), data...)
+		put(p, c.off, c.v)
+		fm, err := NewFlatMatcher(p)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := fm.Verify(); err != ErrInvalidFormat {
+			t.Errorf("%s: got %v, want ErrInvalidFormat", c.name, err)
+		}
+		fm.Count([]byte("ushers abc"))
+	}
+	if fm, err := NewFlatMatcher(data); err != nil || fm.Verify() != nil {
+		t.Errorf("got %v, want a valid matcher", err)
+	}
+	p := append([]byte(nil), data...)
+	put(p, 16, size)
+	if _, err := NewFlatMatcher(p); err != ErrInvalidFormat {
+		t.Errorf("maxLen: got %v, want ErrInvalidFormat", err)
+	}
+
+	// random corruption is matched safely without Verify
+	r := rand.New(rand.NewSource(1))
+	seq := []byte("ushers abc\x00she hers")
+	for round := 0; round < 2000; round++ {
+		p := append([]byte(nil), data...)
+		for i := 0; i < 1+r.Intn(3); i++ {
+			off := flatHeaderSize + 4*r.Intn((len(p)-flatHeaderSize)/4)
+			put(p, off, r.Intn(size+4)-2)
+		}
+		fm, err := NewFlatMatcher(p)
+		if err != nil {
+			continue
+		}
+		fm.MatchFunc(seq, func(start, end int, value []byte) bool {
+			if start < 0 || start >= end || end > len(seq) {
+				t.Fatalf("round %d: match %d-%d", round, start, end)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package cedar
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FoldMode selects case folding of keys and input
+type FoldMode int
+
+const (
+	// FoldNone matches bytes as they are
+	FoldNone FoldMode = iota
+	// FoldASCII folds ASCII letters only
+	FoldASCII
+	// FoldUnicode applies Unicode simple case folding
+	FoldUnicode
+)
+
+// WithFold makes the Matcher case insensitive. Keys are folded on Insert
+// and input is folded on the fly, while offsets of MatchToken still refer
+// to the original input.
+func WithFold(mode FoldMode) MatcherOption {
+	return func(m *Matcher) {
+		m.fold = mode
+	}
+}
+
+// feeder is the input stage of a match, it consumes original bytes
+type feeder interface {
+	feed(b byte)
+	flush()
+}
+
+// newFeeder returns a feeder in front of w,
+// om records offsets of rewritten input.
+func (m *Matcher) newFeeder(w *walker, om *offsetMap) feeder {
+	if !m.rewrites() {
+		return w
+	}
+	return &folder{m: m, w: w, om: om}
+}
+
+// origLen returns the max length in original input of n rewritten bytes
+func (m *Matcher) origLen(n int) int {
+	if m.norm&NormNFKC != 0 {
+		return n*utf8.UTFMax + norm.MaxSegmentSize
+	}
+	if m.rewrites() && !m.asciiOnly() {
+		return n * utf8.UTFMax
+	}
+	return n
+}
+
+func foldASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// foldRune returns the representative of the simple folding orbit of r
+func foldRune(r rune) rune {
+	if r < utf8.RuneSelf {
+		return rune(foldASCII(byte(r)))
+	}
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return unicode.ToLower(min)
+}
+
+// asciiOnly tells whether m folds ASCII bytes only
+func (m *Matcher) asciiOnly() bool {
+	return m.fold == FoldASCII && m.norm == 0 && m.runeMap == nil
+}
+
+// foldKey rewrites a key with the folding options of m
+func (m *Matcher) foldKey(key []byte) []byte {
+	if m.asciiOnly() {
+		out := make([]byte, len(key))
+		for i, b := range key {
+			out[i] = foldASCII(b)
+		}
+		return out
+	}
+	if m.norm&NormNFKC != 0 {
+		key = norm.NFKC.Bytes(key)
+	}
+	return m.appendRewrite(make([]byte, 0, len(key)), key)
+}
+
+// folder rewrites input on the fly before feeding the walker
+type folder struct {
+	m    *Matcher
+	w    *walker
+	om   *offsetMap
+	orig int
+	pend []byte
+	nbuf []byte
+	out  []byte
+}
+
+func (f *folder) feed(b byte) {
+	if f.m.asciiOnly() {
+		f.orig++
+		f.w.feed(foldASCII(b))
+		return
+	}
+	f.pend = append(f.pend, b)
+	f.drain(false)
+}
+
+// drain rewrites complete segments of pending input
+func (f *folder) drain(final bool) {
+	for len(f.pend) > 0 {
+		n := f.m.segment(f.pend, final)
+		if n == 0 {
+			return
+		}
+		seg := f.pend[:n]
+		if f.m.norm&NormNFKC != 0 {
+			f.nbuf = norm.NFKC.Append(f.nbuf[:0], seg...)
+			seg = f.nbuf
+		}
+		f.out = f.m.appendRewrite(f.out[:0], seg)
+		if len(f.out) != n {
+			f.om.add(f.w.offset(), len(f.out), f.orig, n)
+		}
+		f.orig += n
+		for _, c := range f.out {
+			f.w.feed(c)
+		}
+		f.pend = f.pend[:copy(f.pend, f.pend[n:])]
+	}
+}
+
+func (f *folder) flush() {
+	f.drain(true)
+	f.w.flush()
+}
+
+// span is a piece of input whose length changed by rewriting
+type span struct {
+	fed, fedLen   int
+	orig, origLen int
+}
+
+// offsetMap maps positions of rewritten input back to the original input
+type offsetMap struct {
+	spans []span
+}
+
+func (om *offsetMap) reset() {
+	om.spans = om.spans[:0]
+}
+
+func (om *offsetMap) add(fed, fedLen, orig, origLen int) {
+	om.spans = append(om.spans, span{fed: fed, fedLen: fedLen, orig: orig, origLen: origLen})
+}
+
+// locate returns the original range [start, end] of the rewritten byte p
+func (om *offsetMap) locate(p int) (start, end int) {
+	i := sort.Search(len(om.spans), func(i int) bool {
+		return om.spans[i].fed > p
+	}) - 1
+	if i < 0 {
+		return p, p
+	}
+	sp := om.spans[i]
+	if p < sp.fed+sp.fedLen {
+		return sp.orig, sp.orig + sp.origLen - 1
+	}
+	p += sp.orig + sp.origLen - sp.fed - sp.fedLen
+	return p, p
+}
+
+// trim drops spans which end before fed position p
+func (om *offsetMap) trim(p int) {
+	i := sort.Search(len(om.spans), func(i int) bool {
+		sp := om.spans[i]
+		return sp.fed+sp.fedLen > p
+	})
+	if i > 1 {
+		// keep the last dropped span for the delta after it
+		om.spans = om.spans[:copy(om.spans, om.spans[i-1:])]
+	}
+}
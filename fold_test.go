@@ -0,0 +1,46 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFoldASCII(t *testing.T) {
+	m := NewMatcher(WithFold(FoldASCII))
+	m.Insert([]byte("Apple"), 0)
+	m.Insert([]byte("iPhone"), 1)
+	seq := []byte("APPLE iphone Ápple IPHONE")
+	want := "[4:APPLE 11:iphone 25:IPHONE]"
+	if got := fmt.Sprint(collect(m, seq)); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestFoldUnicode(t *testing.T) {
+	words := []string{"straße", "kelvin", "Σοφία", "ok"}
+	// "K" is KELVIN SIGN, "ſ" is LATIN SMALL LETTER LONG S
+	seq := []byte("STRAßE KELVIN σοφία ΣΟΦΊΑ oK straſse")
+	want := "[6:STRAßE 15:KELVIN 26:σοφία 37:ΣΟΦΊΑ 42:oK]"
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostLongest} {
+		m := NewMatcher(WithFold(FoldUnicode), WithMatchKind(kind))
+		for i, w := range words {
+			m.Insert([]byte(w), i)
+		}
+		if got := fmt.Sprint(collect(m, seq)); got != want {
+			t.Fatalf("kind %d: got %s, want %s", kind, got, want)
+		}
+
+		s := m.NewScanner(iotest.OneByteReader(bytes.NewReader(seq)))
+		var got []string
+		for s.Scan() {
+			for _, itr := range s.Tokens() {
+				got = append(got, fmt.Sprintf("%d:%s", itr.At, s.Key(itr)))
+			}
+		}
+		if fmt.Sprint(got) != want {
+			t.Fatalf("kind %d: scanner got %v, want %s", kind, got, want)
+		}
+	}
+}
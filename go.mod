@@ -1,9 +1,11 @@
 module github.com/iohub/ahocorasick
 
-go 1.12
+go 1.23
 
 require (
 	github.com/anknown/ahocorasick v0.0.0-20170415101647-0c5fc0283558
-	github.com/anknown/darts v0.0.0-20151216065714-83ff685239e6 // indirect
 	github.com/cloudflare/ahocorasick v0.0.0-20131126104932-1ce46e42b741
+	golang.org/x/text v0.14.0
 )
+
+require github.com/anknown/darts v0.0.0-20151216065714-83ff685239e6 // indirect
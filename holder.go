@@ -0,0 +1,185 @@
+package cedar
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Holder serves an Automaton which can be reloaded while in use.
+// A reload builds a new snapshot aside and swaps it in atomically,
+// matches running on the previous snapshot finish on it.
+// All methods of Holder are safe for concurrent use.
+type Holder struct {
+	cur      atomic.Pointer[Automaton]
+	load     func() (*Automaton, error)
+	changed  func() bool
+	onError  func(error)
+	interval time.Duration
+	mu       sync.Mutex // serializes reloads
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// HolderOption configures a Holder
+type HolderOption func(*Holder)
+
+// WithPolling reloads the Holder every interval, a file Holder is only
+// reloaded when the modification time or size of its file changed,
+// see NewFileHolder.
+func WithPolling(interval time.Duration) HolderOption {
+	return func(h *Holder) {
+		h.interval = interval
+	}
+}
+
+// WithReloadError sets fn to be called with errors of background reloads,
+// the previous snapshot keeps serving after a failed reload.
+func WithReloadError(fn func(error)) HolderOption {
+	return func(h *Holder) {
+		h.onError = fn
+	}
+}
+
+// NewHolder returns a Holder of the Automaton returned by load,
+// load is called again on every reload.
+func NewHolder(load func() (*Automaton, error), opts ...HolderOption) (*Holder, error) {
+	h := &Holder{load: load}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if err := h.Reload(); err != nil {
+		return nil, err
+	}
+	if h.interval > 0 {
+		h.stop, h.done = make(chan struct{}), make(chan struct{})
+		go h.poll()
+	}
+	return h, nil
+}
+
+// NewFileHolder returns a Holder of the Automaton parsed from the file name,
+// see DictParser and ReadAutomaton for parsers. With polling, the file is
+// reloaded once its modification time and size are the same for two polls,
+// and a failed reload is tried again at the next poll. Writers should still
+// replace the file by renaming a complete one over it, since a file written
+// in place may be read while half written.
+func NewFileHolder(name string, parse func(io.Reader) (*Automaton, error), opts ...HolderOption) (*Holder, error) {
+	// the file of the current snapshot, and the file of the last poll
+	var last, seen os.FileInfo
+	same := func(a, b os.FileInfo) bool {
+		return a != nil && b != nil && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+	}
+	load := func() (*Automaton, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		a, err := parse(bufio.NewReader(f))
+		if err != nil {
+			return nil, err
+		}
+		last = fi
+		return a, nil
+	}
+	changed := func() bool {
+		fi, err := os.Stat(name)
+		if err != nil || same(fi, last) {
+			seen = nil
+			return false
+		}
+		stable := same(fi, seen)
+		seen = fi
+		return stable
+	}
+	return NewHolder(load, append([]HolderOption{func(h *Holder) { h.changed = changed }}, opts...)...)
+}
+
+// Automaton returns the current snapshot, keep it for the whole
+// of a request to get consistent matches.
+func (h *Holder) Automaton() *Automaton {
+	return h.cur.Load()
+}
+
+// Store swaps in a, e.g. one built by the caller
+func (h *Holder) Store(a *Automaton) {
+	h.cur.Store(a)
+}
+
+// Reload loads a new snapshot and swaps it in,
+// the previous snapshot is kept on error.
+func (h *Holder) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, err := h.load()
+	if err != nil {
+		return err
+	}
+	h.cur.Store(a)
+	return nil
+}
+
+// Close stops polling, the current snapshot can still be used
+func (h *Holder) Close() error {
+	h.once.Do(func() {
+		if h.stop != nil {
+			close(h.stop)
+			<-h.done
+		}
+	})
+	return nil
+}
+
+func (h *Holder) poll() {
+	defer close(h.done)
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-t.C:
+		}
+		if h.changed != nil {
+			h.mu.Lock()
+			changed := h.changed()
+			h.mu.Unlock()
+			if !changed {
+				continue
+			}
+		}
+		if err := h.Reload(); err != nil && h.onError != nil {
+			h.onError(err)
+		}
+	}
+}
+
+// DictParser returns a parser of dictionaries with one key per line,
+// the value of a key is its line number starting from 0. Blank lines are skipped.
+func DictParser(opts ...MatcherOption) func(io.Reader) (*Automaton, error) {
+	return func(r io.Reader) (*Automaton, error) {
+		b := NewBuilder(opts...)
+		s := bufio.NewScanner(r)
+		for i := 0; s.Scan(); i++ {
+			if key := bytes.TrimSpace(s.Bytes()); len(key) > 0 {
+				if err := b.Insert(key, i); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return b.Build()
+	}
+}
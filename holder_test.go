@@ -0,0 +1,138 @@
+package cedar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileHolder(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dict.txt")
+	mtime := time.Now()
+	// replace the file at once, as writers should
+	write := func(content string) {
+		tmp := name + ".tmp"
+		if err := os.WriteFile(tmp, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errBroken := errors.New("broken dictionary")
+	parse := func(r io.Reader) (*Automaton, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(data, []byte("broken")) {
+			return nil, errBroken
+		}
+		return DictParser()(bytes.NewReader(data))
+	}
+	write("she\nhe\n")
+	errs := make(chan error, 16)
+	h, err := NewFileHolder(name, parse, WithPolling(time.Millisecond), WithReloadError(func(err error) {
+		// failed reloads are tried again at every poll
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	wait := func(cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatal("timeout")
+			}
+		}
+	}
+	seq := []byte("ushers tong")
+	if got := h.Automaton().Count(seq); got != 2 {
+		t.Fatalf("got %d matches, want 2", got)
+	}
+
+	// match concurrently while reloading
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if n := h.Automaton().Count(seq); n < 2 {
+					t.Errorf("got %d matches", n)
+					return
+				}
+			}
+		}()
+	}
+	write("she\nhe\ntong\n")
+	wait(func() bool { return h.Automaton().Count(seq) == 3 })
+	close(stop)
+	wg.Wait()
+
+	old := h.Automaton()
+	write("broken\n")
+	select {
+	case err := <-errs:
+		if err != errBroken {
+			t.Errorf("got %v, want errBroken", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload error")
+	}
+	if h.Automaton() != old {
+		t.Error("snapshot replaced by a failed reload")
+	}
+	write("she\n")
+	wait(func() bool { return h.Automaton().Count(seq) == 1 })
+	if err := h.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHolder(t *testing.T) {
+	words := []string{"he"}
+	h, err := NewHolder(func() (*Automaton, error) {
+		b := NewBuilder()
+		for i, w := range words {
+			b.Insert([]byte(w), i)
+		}
+		return b.Build()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	seq := []byte("ushers")
+	a := h.Automaton()
+	words = append(words, "she")
+	if err := h.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if a.Count(seq) != 1 || h.Automaton().Count(seq) != 2 {
+		t.Errorf("got %d and %d matches, want 1 and 2", a.Count(seq), h.Automaton().Count(seq))
+	}
+	if _, err := NewHolder(func() (*Automaton, error) { return nil, ErrNoPath }); err != ErrNoPath {
+		t.Errorf("got %v, want ErrNoPath", err)
+	}
+}
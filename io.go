@@ -2,61 +2,597 @@ package cedar
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/json"
+	"hash/crc32"
 	"io"
 	"os"
+	"sort"
 )
 
-// Save saves the cedar to an io.Writer,
-// where dataType is either "json" or "gob".
-func (da *Cedar) Save(out io.Writer, dataType string) error {
+// formatVersion is the version of the binary format written by Encode
+const formatVersion = 1
+
+var cedarMagic = [4]byte{'C', 'D', 'A', 'T'}
+
+// ValueCodec encodes and decodes values of a cedar in the binary format
+type ValueCodec interface {
+	EncodeValue(v interface{}) ([]byte, error)
+	DecodeValue(data []byte) (interface{}, error)
+}
+
+// GobCodec encodes values with encoding/gob,
+// types other than builtin ones must be registered by gob.Register.
+var GobCodec ValueCodec = gobCodec{}
+
+// JSONCodec encodes values with encoding/json,
+// numbers are decoded as float64.
+var JSONCodec ValueCodec = jsonCodec{}
+
+type gobCodec struct{}
+
+type gobValue struct {
+	V interface{}
+}
+
+func (gobCodec) EncodeValue(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(gobValue{V: v})
+	return buf.Bytes(), err
+}
+
+func (gobCodec) DecodeValue(data []byte) (interface{}, error) {
+	var v gobValue
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v.V, err
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) EncodeValue(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) DecodeValue(data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// encodeWith returns the value encoder of cedar.encode for codec
+func encodeWith(codec ValueCodec) func(k int, v interface{}) ([]byte, error) {
+	if codec == nil {
+		codec = GobCodec
+	}
+	return func(k int, v interface{}) ([]byte, error) {
+		return codec.EncodeValue(v)
+	}
+}
+
+// decodeWith returns the value decoder of decodeCedar for codec
+func decodeWith(codec ValueCodec) func(k int, data []byte) (interface{}, error) {
+	if codec == nil {
+		codec = GobCodec
+	}
+	return func(k int, data []byte) (interface{}, error) {
+		return codec.DecodeValue(data)
+	}
+}
+
+func codecOf(dataType string) (ValueCodec, error) {
 	switch dataType {
 	case "gob", "GOB":
-		dataEecoder := gob.NewEncoder(out)
-		return dataEecoder.Encode(da)
+		return GobCodec, nil
 	case "json", "JSON":
-		dataEecoder := json.NewEncoder(out)
-		return dataEecoder.Encode(da)
+		return JSONCodec, nil
+	}
+	return nil, ErrInvalidDataType
+}
+
+// Encode writes the cedar to w in a versioned and checksummed binary
+// format, values are encoded by codec, GobCodec if nil.
+func (da *Cedar) Encode(w io.Writer, codec ValueCodec) error {
+	var e encoder
+	if err := da.encode(&e, encodeWith(codec)); err != nil {
+		return err
+	}
+	return writeFrame(w, cedarMagic, e.buf)
+}
+
+// DecodeCedar reads a cedar written by Encode from r,
+// values are decoded by codec, GobCodec if nil.
+func DecodeCedar(r io.Reader, codec ValueCodec) (*Cedar, error) {
+	return readCedar(r, decodeWith(codec))
+}
+
+// readCedar reads a cedar written by Encode from r,
+// value decodes the value of value key k.
+func readCedar(r io.Reader, value func(k int, data []byte) (interface{}, error)) (*Cedar, error) {
+	body, err := readFrame(r, cedarMagic)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{buf: body}
+	da, err := decodeCedar(&d, value)
+	if err == nil && len(d.buf) != 0 {
+		err = ErrInvalidFormat
+	}
+	return da, err
+}
+
+// Save saves the cedar to an io.Writer in the binary format of Encode,
+// where dataType is either "json" or "gob" and selects the value codec.
+func (da *Cedar) Save(out io.Writer, dataType string) error {
+	codec, err := codecOf(dataType)
+	if err != nil {
+		return err
 	}
-	return ErrInvalidDataType
+	return da.Encode(out, codec)
 }
 
 // SaveToFile saves the cedar to a file,
 // where dataType is either "json" or "gob".
 func (da *Cedar) SaveToFile(fileName string, dataType string) error {
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY, 0666)
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 	out := bufio.NewWriter(file)
-	defer out.Flush()
-	return da.Save(out, dataType)
+	if err = da.Save(out, dataType); err == nil {
+		err = out.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
-// Load loads the cedar from an io.Writer,
-// where dataType is either "json" or "gob".
+// Load loads the cedar from an io.Reader,
+// where dataType is either "json" or "gob" as given to Save.
 func (da *Cedar) Load(in io.Reader, dataType string) error {
-	switch dataType {
-	case "gob", "GOB":
-		dataDecoder := gob.NewDecoder(in)
-		return dataDecoder.Decode(da)
-	case "json", "JSON":
-		dataDecoder := json.NewDecoder(in)
-		return dataDecoder.Decode(da)
+	codec, err := codecOf(dataType)
+	if err != nil {
+		return err
+	}
+	loaded, err := DecodeCedar(in, codec)
+	if err != nil {
+		return err
 	}
-	return ErrInvalidDataType
+	*da = *loaded
+	return nil
 }
 
 // LoadFromFile loads the cedar from a file,
 // where dataType is either "json" or "gob".
 func (da *Cedar) LoadFromFile(fileName string, dataType string) error {
 	file, err := os.OpenFile(fileName, os.O_RDONLY, 0600)
-	defer file.Close()
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 	in := bufio.NewReader(file)
 	return da.Load(in, dataType)
 }
+
+// encode appends the cedar to e, value encodes the value of value key k
+func (da *Cedar) encode(e *encoder, value func(k int, v interface{}) ([]byte, error)) error {
+	for _, v := range []int{da.vkey, da.seq, da.bheadF, da.bheadC, da.bheadO, da.capacity, da.size, da.maxTrial} {
+		e.int(v)
+	}
+	e.bool(da.ordered)
+	for _, v := range da.reject {
+		e.int(v)
+	}
+	e.int(len(da.array))
+	for _, n := range da.array {
+		e.int(n.Value)
+		e.int(n.Check)
+	}
+	e.int(len(da.info))
+	for _, n := range da.info {
+		e.buf = append(e.buf, n.Sibling, n.Child)
+		e.bool(n.End)
+	}
+	e.int(len(da.blocks))
+	for _, b := range da.blocks {
+		for _, v := range []int{b.Prev, b.Next, b.Num, b.reject, b.Trial, b.Ehead} {
+			e.int(v)
+		}
+	}
+	keys := make([]int, 0, len(da.vals))
+	for k := range da.vals {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	e.int(len(keys))
+	for _, k := range keys {
+		v := da.vals[k]
+		data, err := value(k, v.Value)
+		if err != nil {
+			return err
+		}
+		e.int(k)
+		e.int(v.Len)
+		e.int(v.Seq)
+		e.bool(v.Word)
+		e.bytes(data)
+	}
+	return nil
+}
+
+// decodeCedar reads a cedar appended by encode,
+// value decodes the value of value key k.
+func decodeCedar(d *decoder, value func(k int, data []byte) (interface{}, error)) (*Cedar, error) {
+	da := &Cedar{}
+	for _, p := range []*int{&da.vkey, &da.seq, &da.bheadF, &da.bheadC, &da.bheadO, &da.capacity, &da.size, &da.maxTrial} {
+		*p = d.int()
+	}
+	da.ordered = d.bool()
+	for i := range da.reject {
+		da.reject[i] = d.int()
+	}
+	da.array = make([]node, d.len(2))
+	for i := range da.array {
+		da.array[i] = node{Value: d.int(), Check: d.int()}
+	}
+	da.info = make([]ninfo, d.len(3))
+	for i := range da.info {
+		da.info[i] = ninfo{Sibling: d.byte(), Child: d.byte(), End: d.bool()}
+	}
+	da.blocks = make([]block, d.len(6))
+	for i := range da.blocks {
+		b := &da.blocks[i]
+		for _, p := range []*int{&b.Prev, &b.Next, &b.Num, &b.reject, &b.Trial, &b.Ehead} {
+			*p = d.int()
+		}
+	}
+	n := d.len(5)
+	da.vals = make(map[int]nvalue, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		k := d.int()
+		v := nvalue{Len: d.int(), Seq: d.int(), Word: d.bool()}
+		data := d.bytes()
+		if d.err != nil {
+			break
+		}
+		if k <= 0 || k >= len(da.array) {
+			return nil, ErrInvalidFormat
+		}
+		var err error
+		if v.Value, err = value(k, data); err != nil {
+			return nil, err
+		}
+		da.vals[k] = v
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if da.size == 0 || da.size > len(da.array) || len(da.info) != len(da.array) || da.capacity != len(da.array) ||
+		da.size&255 != 0 || da.size>>8 > len(da.blocks) || !da.valid() {
+		return nil, ErrInvalidFormat
+	}
+	da.used = da.usedNodes()
+	return da, nil
+}
+
+// valid checks the references of nodes and blocks, so that walks and
+// updates of a decoded cedar stay in range
+func (da *Cedar) valid() bool {
+	nb := da.size >> 8
+	if da.vkey < 0 || da.vkey >= da.capacity {
+		return false
+	}
+	for _, h := range []int{da.bheadF, da.bheadC, da.bheadO} {
+		if h < 0 || h >= nb {
+			return false
+		}
+	}
+	for i, b := range da.blocks[:nb] {
+		if b.Prev < 0 || b.Prev >= nb || b.Next < 0 || b.Next >= nb ||
+			b.Num < 0 || b.Num > 256 || b.Ehead>>8 != i {
+			return false
+		}
+	}
+	for i, n := range da.array[:da.size] {
+		switch {
+		case n.Check < 0:
+			// a free node, linked to free nodes of its block
+			if -n.Value>>8 != i>>8 || -n.Check>>8 != i>>8 {
+				return false
+			}
+		case n.Check >= da.size:
+			return false
+		case n.Value < 0:
+			if n.base() >= da.size {
+				return false
+			}
+		default:
+			if _, ok := da.vals[n.Value]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// writeFrame writes magic, the format version, body and its checksum
+func writeFrame(w io.Writer, magic [4]byte, body []byte) error {
+	var head [8]byte
+	copy(head[:], magic[:])
+	binary.LittleEndian.PutUint32(head[4:], formatVersion)
+	sum := crc32.Update(crc32.ChecksumIEEE(head[:]), crc32.IEEETable, body)
+	var tail [4]byte
+	binary.LittleEndian.PutUint32(tail[:], sum)
+	for _, p := range [][]byte{head[:], body, tail[:]} {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads and checks a frame written by writeFrame, returns its body
+func readFrame(r io.Reader, magic [4]byte) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || !bytes.Equal(data[:4], magic[:]) {
+		return nil, ErrInvalidFormat
+	}
+	if binary.LittleEndian.Uint32(data[4:]) != formatVersion {
+		return nil, ErrVersion
+	}
+	end := len(data) - 4
+	if crc32.ChecksumIEEE(data[:end]) != binary.LittleEndian.Uint32(data[end:]) {
+		return nil, ErrChecksum
+	}
+	return data[8:end], nil
+}
+
+// encoder appends varints to buf
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int(v int) {
+	e.buf = binary.AppendVarint(e.buf, int64(v))
+}
+
+func (e *encoder) bool(v bool) {
+	var b byte
+	if v {
+		b = 1
+	}
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) bytes(p []byte) {
+	e.int(len(p))
+	e.buf = append(e.buf, p...)
+}
+
+// decoder consumes buf written by encoder, the first error sticks
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrInvalidFormat
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.buf) == 0 {
+		d.err = ErrInvalidFormat
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+// len reads a count of items taking at least size bytes each
+func (d *decoder) len(size int) int {
+	n := d.int()
+	if n < 0 || n > len(d.buf)/size {
+		d.err = ErrInvalidFormat
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.len(1)
+	p := d.buf[:n]
+	d.buf = d.buf[n:]
+	return p
+}
+
+var matcherMagic = [4]byte{'A', 'C', 'M', 'T'}
+
+// WriteTo writes the compiled matcher to w with values encoded by GobCodec,
+// it implements io.WriterTo. See Encode.
+func (m *Matcher) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	err := m.Encode(cw, GobCodec)
+	return cw.n, err
+}
+
+// Encode compiles m if needed and writes the trie, fail and output links
+// and the options of m to w, values are encoded by codec, GobCodec if nil.
+// Functions given by WithRuneMap and WithWordRunes are not written,
+// pass them again to DecodeMatcher.
+func (m *Matcher) Encode(w io.Writer, codec ValueCodec) error {
+	return m.encode(w, encodeWith(codec))
+}
+
+// encode writes m to w, value encodes the value of value key k
+func (m *Matcher) encode(w io.Writer, value func(k int, v interface{}) ([]byte, error)) error {
+	if err := m.Compile(); err != nil {
+		return err
+	}
+	var e encoder
+	for _, v := range []int{int(m.kind), int(m.fold), int(m.norm), m.maxLen} {
+		e.int(v)
+	}
+	for _, v := range []bool{m.runeSafe, m.words.all, m.hasWords} {
+		e.bool(v)
+	}
+	if err := m.da.encode(&e, value); err != nil {
+		return err
+	}
+	e.int(len(m.fails))
+	for i, fid := range m.fails {
+		e.int(fid)
+		e.int(m.depth[i])
+		e.int(m.longest[i])
+		e.int(m.outputs[i].vKey)
+		e.bool(m.outputs[i].link)
+	}
+	return writeFrame(w, matcherMagic, e.buf)
+}
+
+// ReadMatcher reads a matcher written by WriteTo from r, ready for
+// matching without Compile. opts are applied after the written options,
+// it returns ErrTooLarge if the matcher exceeds limits given by opts.
+func ReadMatcher(r io.Reader, opts ...MatcherOption) (*Matcher, error) {
+	return DecodeMatcher(r, GobCodec, opts...)
+}
+
+// DecodeMatcher reads a matcher written by Encode from r, values are
+// decoded by codec, GobCodec if nil. opts are applied after the written options.
+func DecodeMatcher(r io.Reader, codec ValueCodec, opts ...MatcherOption) (*Matcher, error) {
+	return readMatcher(r, decodeWith(codec), opts...)
+}
+
+// readMatcher reads a matcher written by Encode from r,
+// value decodes the value of value key k.
+func readMatcher(r io.Reader, value func(k int, data []byte) (interface{}, error), opts ...MatcherOption) (*Matcher, error) {
+	body, err := readFrame(r, matcherMagic)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: body}
+	m := &Matcher{
+		kind:   MatchKind(d.int()),
+		fold:   FoldMode(d.int()),
+		norm:   NormMode(d.int()),
+		maxLen: d.int(),
+	}
+	m.runeSafe, m.words.all, m.hasWords = d.bool(), d.bool(), d.bool()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if m.da, err = decodeCedar(d, value); err != nil {
+		return nil, err
+	}
+	n := d.len(5)
+	if n != len(m.da.array) {
+		return nil, ErrInvalidFormat
+	}
+	m.fails = make([]int, n)
+	m.depth = make([]int, n)
+	m.longest = make([]int, n)
+	m.outputs = make([]outNode, n)
+	for i := 0; i < n; i++ {
+		m.fails[i], m.depth[i], m.longest[i] = d.int(), d.int(), d.int()
+		m.outputs[i].vKey = d.int()
+		m.outputs[i].link = d.bool()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(d.buf) != 0 || !m.validLinks() {
+		return nil, ErrInvalidFormat
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.da.checkLimits(); err != nil {
+		return nil, err
+	}
+	m.compiled = true
+	m.resetBackward()
+	return m, nil
+}
+
+// validLinks checks the decoded links of nodes: fail links of nodes
+// reached by keys lead to shallower nodes, so that walks end, depths are
+// the ones of the trie and value keys are the ones of values
+func (m *Matcher) validLinks() bool {
+	da := m.da
+	for _, v := range da.vals {
+		if v.Len > m.maxLen {
+			return false
+		}
+	}
+	if m.maxLen > len(m.fails) {
+		return false
+	}
+	hasValue := func(vk int) bool {
+		_, ok := da.vals[vk]
+		return vk == 0 || ok
+	}
+	for i, f := range m.fails {
+		if f < -1 || f >= len(m.fails) || !hasValue(m.outputs[i].vKey) || !hasValue(m.longest[i]) {
+			return false
+		}
+		if i == 0 {
+			if f != 0 || m.depth[0] != 0 {
+				return false
+			}
+			continue
+		}
+		if i >= da.size || da.array[i].Check < 0 || da.array[da.array[i].Check].base()^i == 0 {
+			// a free node or a value node, not reached by keys
+			if m.outputs[i].link {
+				return false
+			}
+			continue
+		}
+		p, d := da.array[i].Check, m.depth[i]
+		if f < 0 || d != m.depth[p]+1 || d > m.maxLen || m.depth[f] >= d {
+			return false
+		}
+	}
+	return true
+}
+
+// NewMatcherFromCedar returns a matcher using da as its trie, e.g. one read
+// by DecodeCedar. Keys of da must already be rewritten as opts would do,
+// the matcher must be compiled before matching.
+func NewMatcherFromCedar(da *Cedar, opts ...MatcherOption) *Matcher {
+	m := &Matcher{da: da}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// countWriter counts bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,175 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func dumpCedar(da *Cedar) string {
+	var out []string
+	for m := range da.All() {
+		out = append(out, fmt.Sprintf("%s:%v", m.Key, m.Value))
+	}
+	return fmt.Sprint(out)
+}
+
+func TestEncode(t *testing.T) {
+	da := NewCedar()
+	for i := 0; i < 2000; i++ {
+		da.Insert([]byte(fmt.Sprintf("key%d", i*7)), i)
+	}
+	da.Insert([]byte("中文"), "value")
+	da.Delete([]byte("key7"))
+	want := dumpCedar(da)
+
+	var buf bytes.Buffer
+	if err := da.Encode(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	loaded, err := DecodeCedar(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dumpCedar(loaded); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// the loaded cedar keeps accepting updates
+	loaded.Insert([]byte("key7"), 1)
+	loaded.Insert([]byte("new"), 2)
+	if v, err := loaded.Get([]byte("new")); err != nil || v.(int) != 2 {
+		t.Errorf("Get new got %v, %v", v, err)
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)/2] ^= 1
+	if _, err := DecodeCedar(bytes.NewReader(corrupt), nil); err != ErrChecksum {
+		t.Errorf("corrupt got %v, want ErrChecksum", err)
+	}
+	if _, err := DecodeCedar(bytes.NewReader(data[:len(data)-1]), nil); err != ErrChecksum {
+		t.Errorf("truncated got %v, want ErrChecksum", err)
+	}
+	corrupt = append([]byte(nil), data...)
+	corrupt[4] = 99
+	if _, err := DecodeCedar(bytes.NewReader(corrupt), nil); err != ErrVersion {
+		t.Errorf("version got %v, want ErrVersion", err)
+	}
+	if _, err := DecodeCedar(bytes.NewReader([]byte("garbage data")), nil); err != ErrInvalidFormat {
+		t.Errorf("garbage got %v, want ErrInvalidFormat", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	da := NewCedar()
+	for i, word := range []string{"she", "he", "her", "hers"} {
+		da.Insert([]byte(word), i)
+	}
+	for _, dataType := range []string{"gob", "json"} {
+		fname := filepath.Join(t.TempDir(), "cedar."+dataType)
+		if err := da.SaveToFile(fname, dataType); err != nil {
+			t.Fatal(err)
+		}
+		loaded := NewCedar()
+		if err := loaded.LoadFromFile(fname, dataType); err != nil {
+			t.Fatal(err)
+		}
+		want := "[he:1 her:2 hers:3 she:0]"
+		if got := dumpCedar(loaded); got != want {
+			t.Errorf("%s got %s, want %s", dataType, got, want)
+		}
+	}
+	if err := da.Save(&bytes.Buffer{}, "xml"); err != ErrInvalidDataType {
+		t.Errorf("got %v, want ErrInvalidDataType", err)
+	}
+}
+
+func TestMatcherWriteTo(t *testing.T) {
+	words := []string{"she", "he", "her", "hers", "Ｈｉｓ"}
+	seq := []byte("ushershertongher HIS")
+	for _, opts := range [][]MatcherOption{
+		nil,
+		{WithMatchKind(MatchLeftmostLongest), WithFold(FoldUnicode), WithNormalize(NormWidth)},
+		{WithWholeWords(), WithRuneSafe()},
+	} {
+		m := NewMatcher(opts...)
+		for i, word := range words {
+			m.Insert([]byte(word), i)
+		}
+		var buf bytes.Buffer
+		n, err := m.WriteTo(&buf)
+		if err != nil || n != int64(buf.Len()) {
+			t.Fatalf("WriteTo got %d, %v", n, err)
+		}
+		loaded, err := ReadMatcher(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprint(spans(loaded, seq)), fmt.Sprint(spans(m, seq)); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+
+	cd := NewCedar()
+	for i, word := range words[:4] {
+		cd.Insert([]byte(word), i)
+	}
+	var buf bytes.Buffer
+	if err := cd.Encode(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	cd, err := DecodeCedar(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMatcherFromCedar(cd)
+	m.Compile()
+	if got, want := fmt.Sprint(spans(m, seq)), "[1-3 2-3 2-4 2-5 5-7 6-7 6-8 13-14 13-15]"; got != want {
+		t.Errorf("NewMatcherFromCedar got %s, want %s", got, want)
+	}
+	if _, err := ReadMatcher(bytes.NewReader([]byte("CDAT"))); err != ErrInvalidFormat {
+		t.Errorf("got %v, want ErrInvalidFormat", err)
+	}
+}
+
+func TestDecodeMatcherCorrupted(t *testing.T) {
+	newMatcher := func() (*Matcher, []int) {
+		m := NewMatcher()
+		for i, word := range []string{"she", "he", "her", "hers"} {
+			m.Insert([]byte(word), i)
+		}
+		m.Compile()
+		return m, m.path([]byte("hers"))
+	}
+	cases := []struct {
+		name    string
+		corrupt func(m *Matcher, hers []int)
+	}{
+		{"fail out of range", func(m *Matcher, hers []int) { m.fails[hers[3]] = len(m.fails) }},
+		{"no fail", func(m *Matcher, hers []int) { m.fails[hers[3]] = -1 }},
+		{"fail to itself", func(m *Matcher, hers []int) { m.fails[hers[3]] = hers[3] }},
+		{"fail to a deeper node", func(m *Matcher, hers []int) { m.fails[hers[1]] = hers[3] }},
+		{"depth", func(m *Matcher, hers []int) { m.depth[hers[2]] = 7 }},
+		{"output value key", func(m *Matcher, hers []int) { m.outputs[hers[3]].vKey = 100 }},
+		{"longest value key", func(m *Matcher, hers []int) { m.longest[hers[3]] = -1 }},
+		{"max length", func(m *Matcher, hers []int) { m.maxLen = 2 }},
+		{"check out of range", func(m *Matcher, hers []int) { m.da.array[hers[3]].Check = m.da.size }},
+		{"base out of range", func(m *Matcher, hers []int) { m.da.array[hers[2]].Value = -m.da.size - 1 }},
+		{"node value key", func(m *Matcher, hers []int) { m.da.array[hers[3]].Value = 100 }},
+		{"free node link", func(m *Matcher, hers []int) { m.da.array[200].Check = -m.da.size }},
+		{"block head", func(m *Matcher, hers []int) { m.da.blocks[0].Ehead = m.da.size }},
+		{"value key", func(m *Matcher, hers []int) { m.da.vals[-1] = nvalue{} }},
+	}
+	for _, c := range cases {
+		m, hers := newMatcher()
+		c.corrupt(m, hers)
+		var buf bytes.Buffer
+		if err := m.Encode(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeMatcher(&buf, nil); err != ErrInvalidFormat {
+			t.Errorf("%s: got %v, want ErrInvalidFormat", c.name, err)
+		}
+	}
+}
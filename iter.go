@@ -0,0 +1,78 @@
+package cedar
+
+import (
+	"iter"
+)
+
+// Match is a key yielded by iterators, Key is seq[Start:End] of the
+// searched input, or the whole key with Start 0 for Cedar iterators.
+type Match struct {
+	Start, End int
+	Key        []byte
+	Value      interface{}
+}
+
+// All returns an iterator over matches in seq, in the order of Match.
+// Key of each Match refers to seq.
+func (m *Matcher) All(seq []byte) iter.Seq[Match] {
+	return func(yield func(Match) bool) {
+		m.MatchFunc(seq, func(start, end int, value interface{}) bool {
+			return yield(Match{Start: start, End: end, Key: seq[start:end], Value: value})
+		})
+	}
+}
+
+// All returns an iterator over all keys of the cedar, ordered by keys
+func (da *Cedar) All() iter.Seq[Match] {
+	return da.PrefixPredictSeq(nil)
+}
+
+// PrefixPredictSeq returns an iterator over keys which have key as their
+// prefix, ordered by keys. It is the iterator form of PrefixPredict.
+func (da *Cedar) PrefixPredictSeq(key []byte) iter.Seq[Match] {
+	return func(yield func(Match) bool) {
+		root, err := da.Jump(key, 0)
+		if err != nil {
+			return
+		}
+		for from, err := da.begin(root); err == nil; from, err = da.next(from, root) {
+			m, ok := da.match(from)
+			if ok && !yield(m) {
+				return
+			}
+		}
+	}
+}
+
+// PrefixMatchSeq returns an iterator over keys which are prefixes of key,
+// shortest first. It is the iterator form of PrefixMatch.
+func (da *Cedar) PrefixMatchSeq(key []byte) iter.Seq[Match] {
+	return func(yield func(Match) bool) {
+		for from, i := 0, 0; i < len(key); i++ {
+			to, err := da.Jump(key[i:i+1], from)
+			if err != nil {
+				return
+			}
+			if vk, err := da.vKeyOf(to); err == nil {
+				m := Match{End: i + 1, Key: key[:i+1], Value: da.vals[vk].Value}
+				if !yield(m) {
+					return
+				}
+			}
+			from = to
+		}
+	}
+}
+
+// match returns the key and value of node id
+func (da *Cedar) match(id int) (Match, bool) {
+	key, err := da.Key(id)
+	if err != nil {
+		return Match{}, false
+	}
+	vk, err := da.vKeyOf(id)
+	if err != nil {
+		return Match{}, false
+	}
+	return Match{End: len(key), Key: key, Value: da.vals[vk].Value}, true
+}
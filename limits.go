@@ -0,0 +1,195 @@
+package cedar
+
+import "unsafe"
+
+// limits bounds the resources used by a cedar, 0 means no limit
+type limits struct {
+	maxKeys   int
+	maxKeyLen int
+	maxNodes  int
+}
+
+// WithMaxKeys limits the number of keys
+func WithMaxKeys(n int) CedarOption {
+	return func(da *Cedar) {
+		da.maxKeys = n
+	}
+}
+
+// WithMaxKeyLen limits the length of keys in bytes
+func WithMaxKeyLen(n int) CedarOption {
+	return func(da *Cedar) {
+		da.maxKeyLen = n
+	}
+}
+
+// WithMaxNodes limits the number of trie nodes, which bounds memory:
+// a node takes about 20 bytes in a Cedar and 40 more in a compiled
+// Matcher, twice as much for leftmost kinds which also compile the
+// reversed keys. The node arrays grow by doubling up to the limit.
+func WithMaxNodes(n int) CedarOption {
+	return func(da *Cedar) {
+		da.maxNodes = n
+	}
+}
+
+// WithCedarOptions applies opts to the cedar of the matcher,
+// e.g. limits or the initial capacity.
+func WithCedarOptions(opts ...CedarOption) MatcherOption {
+	return func(m *Matcher) {
+		for _, opt := range opts {
+			opt(m.da)
+		}
+	}
+}
+
+// checkInsert returns ErrTooLarge if inserting key would exceed a limit
+func (da *Cedar) checkInsert(key []byte) error {
+	if da.maxKeyLen > 0 && len(key) > da.maxKeyLen {
+		return ErrTooLarge
+	}
+	if da.maxKeys <= 0 && da.maxNodes <= 0 {
+		return nil
+	}
+	// follow the existing path of key
+	nid, n := 0, 0
+	for ; n < len(key); n++ {
+		to, err := da.child(nid, key[n])
+		if err != nil {
+			break
+		}
+		nid = to
+	}
+	if n == len(key) {
+		if _, err := da.vKeyOf(nid); err == nil {
+			// an update of the value
+			return nil
+		}
+	}
+	if da.maxKeys > 0 && len(da.vals) >= da.maxKeys {
+		return ErrTooLarge
+	}
+	// new nodes of the path and at most one for a value
+	if da.maxNodes > 0 && da.used+len(key)-n+1 > da.maxNodes {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// checkLimits returns ErrTooLarge if the cedar exceeds a limit
+func (da *Cedar) checkLimits() error {
+	if da.maxKeys > 0 && len(da.vals) > da.maxKeys {
+		return ErrTooLarge
+	}
+	if da.maxNodes > 0 && da.used > da.maxNodes {
+		return ErrTooLarge
+	}
+	if da.maxKeyLen > 0 {
+		for _, v := range da.vals {
+			if v.Len > da.maxKeyLen {
+				return ErrTooLarge
+			}
+		}
+	}
+	return nil
+}
+
+// usedNodes counts the nodes in use from the free nodes of blocks,
+// the root is not counted as free in the first block.
+func (da *Cedar) usedNodes() int {
+	n := da.size + 1
+	for _, b := range da.blocks[:da.size>>8] {
+		n -= b.Num
+	}
+	return n
+}
+
+// MatchOption bounds a single call of Match
+type MatchOption func(*matchLimits)
+
+// matchLimits bounds the matches buffered by a Response, 0 means no limit
+type matchLimits struct {
+	maxMatches int
+	maxBytes   int
+}
+
+// WithMaxMatches stops matching after n matches
+func WithMaxMatches(n int) MatchOption {
+	return func(l *matchLimits) {
+		l.maxMatches = n
+	}
+}
+
+// WithMaxBufferedBytes stops matching before the buffered matches
+// take more than n bytes of memory, about 24 bytes per end position.
+// The bound is approximate: a pooled buffer of DefaultMatchBufferSize
+// positions is used whatever n is, and the offsets kept by rewriting
+// matchers are not counted.
+func WithMaxBufferedBytes(n int) MatchOption {
+	return func(l *matchLimits) {
+		l.maxBytes = n
+	}
+}
+
+// add buffers at within the limits of r, the matches of at which
+// do not fit are dropped and r is truncated
+func (r *Response) add(at matchAt) {
+	if r.truncated {
+		return
+	}
+	l := r.limits
+	if l == (matchLimits{}) {
+		r.buf.addAt(at)
+		return
+	}
+	if l.maxBytes > 0 {
+		size := int(unsafe.Sizeof(at))
+		if (r.buf.atIdx+1)*size > l.maxBytes {
+			r.truncated = true
+			return
+		}
+		if r.buf.atIdx == len(r.buf.at) {
+			// grow up to the limit rather than doubling past it
+			r.buf.growTo(min(2*r.buf.atIdx, l.maxBytes/size))
+		}
+	}
+	if l.maxMatches <= 0 {
+		r.buf.addAt(at)
+		return
+	}
+	if at.VKey != 0 {
+		if r.matches == l.maxMatches {
+			r.truncated = true
+			return
+		}
+		r.matches++
+		r.buf.addAt(at)
+		return
+	}
+	if n := r.ac.outputsOf(at); r.matches+n <= l.maxMatches {
+		r.matches += n
+		r.buf.addAt(at)
+		return
+	}
+	// keep the first words of at one by one
+	for e := at.OutID; e > 0 && r.matches < l.maxMatches && !r.truncated; e = r.ac.outLink(e) {
+		if vk := r.ac.outputs[e].vKey; vk != 0 {
+			r.add(matchAt{At: at.At, OutID: at.OutID, VKey: vk})
+		}
+	}
+	r.truncated = true
+}
+
+// outputsOf returns the number of matches of at
+func (m *Matcher) outputsOf(at matchAt) int {
+	if at.VKey != 0 {
+		return 1
+	}
+	n := 0
+	for e := at.OutID; e > 0; e = m.outLink(e) {
+		if m.outputs[e].vKey != 0 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,170 @@
+package cedar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestCedarLimits(t *testing.T) {
+	da := NewCedar(WithMaxKeys(2), WithMaxKeyLen(3))
+	for _, key := range []string{"he", "she", "he"} {
+		if err := da.Insert([]byte(key), 0); err != nil {
+			t.Fatalf("Insert %s: %v", key, err)
+		}
+	}
+	for _, key := range []string{"her", "hers"} {
+		if err := da.Insert([]byte(key), 0); err != ErrTooLarge {
+			t.Errorf("Insert %s got %v, want ErrTooLarge", key, err)
+		}
+	}
+	da.Delete([]byte("he"))
+	if err := da.Insert([]byte("her"), 0); err != nil {
+		t.Error(err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	da = NewCedar(WithMaxNodes(4096))
+	var err error
+	for err == nil {
+		key := make([]byte, 1+r.Intn(12))
+		r.Read(key)
+		err = da.Insert(bytes.ReplaceAll(key, []byte{0}, []byte{1}), 0)
+	}
+	if err != ErrTooLarge || da.used > 4096 || da.used != da.usedNodes() || da.capacity > 8192 {
+		t.Errorf("got %v with %d nodes of %d", err, da.used, da.capacity)
+	}
+
+	var buf bytes.Buffer
+	if err := da.Encode(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := DecodeCedar(&buf, nil); err != nil || dec.used != da.used {
+		t.Errorf("decoded %v", err)
+	}
+}
+
+func TestBuildCedarLimits(t *testing.T) {
+	kvs := []KeyValue{{Key: []byte("she")}, {Key: []byte("he")}, {Key: []byte("her")}, {Key: []byte("hers")}}
+	da, err := BuildCedar(kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if da.used != da.usedNodes() {
+		t.Errorf("%d nodes, counted %d", da.used, da.usedNodes())
+	}
+	for _, opt := range []CedarOption{WithMaxKeys(3), WithMaxKeyLen(3), WithMaxNodes(da.used - 1)} {
+		if _, err := BuildCedar(kvs, opt); err != ErrTooLarge {
+			t.Errorf("got %v, want ErrTooLarge", err)
+		}
+	}
+	if _, err := BuildCedar(kvs, WithMaxNodes(da.used)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMatcherLimits(t *testing.T) {
+	m := NewMatcher(WithCedarOptions(WithMaxKeys(2)))
+	for _, key := range []string{"", " \t"} {
+		if err := m.Insert([]byte(key), 0); err != ErrInvalidKey {
+			t.Errorf("Insert %q got %v, want ErrInvalidKey", key, err)
+		}
+	}
+	m.Insert([]byte("he"), 0)
+	m.Compile()
+	m.Insert([]byte("she"), 1)
+	if err := m.Insert([]byte("hers"), 2); err != ErrTooLarge {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+	if got := fmt.Sprint(spans(m, []byte("ushers"))); got != "[1-3 2-3]" {
+		t.Errorf("got %s", got)
+	}
+
+	// limits of a loaded cedar are checked by Compile
+	newCedar := func() *Cedar {
+		da := NewCedar()
+		for _, key := range []string{"she", "he", "her"} {
+			da.Insert([]byte(key), key)
+		}
+		return da
+	}
+	m = NewMatcherFromCedar(newCedar(), WithCedarOptions(WithMaxKeys(2)))
+	if err := m.Compile(); err != ErrTooLarge {
+		t.Errorf("Compile got %v, want ErrTooLarge", err)
+	}
+	seq := []byte("ushers")
+	if m.Count(seq) != 0 || m.ContainsAny(seq) || NewReplacer(m).ReplaceString("ushers") != "" {
+		t.Error("match on a matcher failing to compile")
+	}
+	var out bytes.Buffer
+	if n, err := NewReplacer(m).WriteBytes(&out, seq); n != 0 || err != ErrTooLarge {
+		t.Errorf("WriteBytes got %d, %v", n, err)
+	}
+	if resp, err := m.MatchContext(context.Background(), seq); resp.HasNext() || err != ErrTooLarge {
+		t.Errorf("MatchContext got %v", err)
+	}
+	s := m.NewScanner(strings.NewReader("ushers"))
+	if s.Scan() || s.Err() != ErrTooLarge {
+		t.Errorf("Scanner got %v", s.Err())
+	}
+
+	var buf bytes.Buffer
+	if _, err := NewMatcherFromCedar(newCedar()).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMatcher(&buf, WithCedarOptions(WithMaxKeyLen(2))); err != ErrTooLarge {
+		t.Errorf("ReadMatcher got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestMatchLimits(t *testing.T) {
+	tokens := func(resp *Response, seq []byte) []string {
+		defer resp.Release()
+		var res []string
+		for resp.HasNext() {
+			for _, tk := range resp.NextMatchItem(seq) {
+				res = append(res, fmt.Sprintf("%d:%d", tk.At, tk.KLen))
+			}
+		}
+		return res
+	}
+	seq := bytes.Repeat([]byte("a"), 100)
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostLongest} {
+		m := NewMatcher(WithMatchKind(kind))
+		for i, key := range []string{"a", "aa", "aaa", "aaaa"} {
+			m.Insert([]byte(key), i)
+		}
+		all := tokens(m.Match(seq), seq)
+
+		resp := m.Match(seq, WithMaxMatches(10))
+		truncated := resp.Truncated()
+		if got := tokens(resp, seq); !truncated || fmt.Sprint(got) != fmt.Sprint(all[:10]) {
+			t.Errorf("kind %d: got %v, truncated %v", kind, got, truncated)
+		}
+
+		resp = m.Match(seq, WithMaxMatches(len(all)))
+		truncated = resp.Truncated()
+		if got := tokens(resp, seq); truncated || len(got) != len(all) {
+			t.Errorf("kind %d: got %d matches, truncated %v", kind, len(got), truncated)
+		}
+
+		resp = m.Match(seq, WithMaxBufferedBytes(5*24))
+		truncated = resp.Truncated()
+		if got := tokens(resp, seq); !truncated || len(got) == 0 || fmt.Sprint(got) != fmt.Sprint(all[:len(got)]) {
+			t.Errorf("kind %d: got %v, truncated %v", kind, got, truncated)
+		}
+	}
+
+	// the buffer grows up to the limit, not to the next power of two
+	m := NewMatcher()
+	m.Insert([]byte("a"), 0)
+	seq = bytes.Repeat([]byte("a"), 3*DefaultMatchBufferSize)
+	resp := m.Match(seq, WithMaxBufferedBytes(5*DefaultMatchBufferSize/2*24))
+	if n := len(resp.buf.at); !resp.Truncated() || n != 5*DefaultMatchBufferSize/2 {
+		t.Errorf("buffer of %d positions", n)
+	}
+	resp.Release()
+}
@@ -171,3 +171,79 @@ func TestHugeMatching(t *testing.T) {
 	resp.Release()
 	fmt.Println("done")
 }
+
+func TestMatchFunc(t *testing.T) {
+	words := []string{"she", "he", "her", "hers"}
+	seq := []byte("hershertongher")
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostFirst, MatchLeftmostLongest, MatchLongestPerEnd} {
+		m := NewMatcher(WithMatchKind(kind))
+		for i, word := range words {
+			m.Insert([]byte(word), i)
+		}
+		var got []string
+		m.MatchFunc(seq, func(start, end int, value interface{}) bool {
+			got = append(got, fmt.Sprintf("%d-%d", start, end-1))
+			if words[value.(int)] != string(seq[start:end]) {
+				t.Errorf("value %v of %s", value, seq[start:end])
+			}
+			return true
+		})
+		if want := spans(m, seq); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("kind %d: got %v, want %v", kind, got, want)
+		}
+
+		n := 0
+		m.MatchFunc(seq, func(start, end int, value interface{}) bool {
+			n++
+			return n < 2
+		})
+		if n != 2 {
+			t.Errorf("kind %d: %d calls after stop", kind, n)
+		}
+	}
+}
+
+func TestMatchFuncAllocs(t *testing.T) {
+	m := NewMatcher()
+	for i, word := range []string{"she", "he", "her", "hers"} {
+		m.Insert([]byte(word), i)
+	}
+	m.Compile()
+	seq := []byte("hershertongher xyz")
+	n := 0
+	fn := func(start, end int, value interface{}) bool {
+		n++
+		return true
+	}
+	if allocs := testing.AllocsPerRun(100, func() { m.MatchFunc(seq, fn) }); allocs != 0 {
+		t.Errorf("%v allocs per run", allocs)
+	}
+}
+
+func TestMatcherAll(t *testing.T) {
+	m := NewMatcher(WithMatchKind(MatchLeftmostLongest))
+	for i, word := range []string{"she", "he", "her", "hers"} {
+		m.Insert([]byte(word), i)
+	}
+	seq := []byte("hershertongher")
+	var got []string
+	for mt := range m.All(seq) {
+		got = append(got, fmt.Sprintf("%d-%d:%s:%d", mt.Start, mt.End, mt.Key, mt.Value.(int)))
+	}
+	if want := "[0-4:hers:3 4-7:her:2 11-14:her:2]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	for range m.All(seq) {
+		break
+	}
+}
+
+func TestInsertAfterCompile(t *testing.T) {
+	m := NewMatcher()
+	m.Insert([]byte("he"), 0)
+	m.Compile()
+	m.Insert([]byte("she"), 1)
+	if got := m.Count([]byte("ushers")); got != 2 {
+		t.Errorf("got %d matches, want 2", got)
+	}
+}
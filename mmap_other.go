@@ -0,0 +1,14 @@
+//go:build !unix
+
+package cedar
+
+import "os"
+
+// mapFile reads the file name into memory where mmap is not supported
+func mapFile(name string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
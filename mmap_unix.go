@@ -0,0 +1,30 @@
+//go:build unix
+
+package cedar
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the file name read-only into memory
+func mapFile(name string) ([]byte, func() error, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if size < flatHeaderSize || int64(int(size)) != size {
+		return nil, nil, ErrInvalidFormat
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
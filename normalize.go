@@ -0,0 +1,100 @@
+package cedar
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// NormMode selects Unicode normalization of keys and input, modes may be combined
+type NormMode uint
+
+const (
+	// NormNFKC applies NFKC compatibility composition, so that composed
+	// and decomposed forms and compatibility variants match each other
+	NormNFKC NormMode = 1 << iota
+	// NormWidth folds full-width ASCII to half-width and half-width
+	// CJK forms (e.g. katakana) to full-width
+	NormWidth
+)
+
+// WithNormalize normalizes keys on Insert and input on the fly,
+// offsets of MatchToken still refer to the original input.
+func WithNormalize(mode NormMode) MatcherOption {
+	return func(m *Matcher) {
+		m.norm = mode
+	}
+}
+
+// WithRuneMap installs a hook mapping every rune of keys and input after
+// normalization and case folding, e.g. traditional to simplified Chinese.
+// fn must be a pure function.
+func WithRuneMap(fn func(rune) rune) MatcherOption {
+	return func(m *Matcher) {
+		m.runeMap = fn
+	}
+}
+
+// rewrites tells whether m rewrites keys and input
+func (m *Matcher) rewrites() bool {
+	return m.fold != FoldNone || m.norm != 0 || m.runeMap != nil
+}
+
+// mapRune maps r by width folding, case folding and the rune hook
+func (m *Matcher) mapRune(r rune) rune {
+	if m.norm&NormWidth != 0 && r >= utf8.RuneSelf {
+		if f := width.LookupRune(r).Folded(); f != 0 {
+			r = f
+		}
+	}
+	switch m.fold {
+	case FoldASCII:
+		if r < utf8.RuneSelf {
+			r = rune(foldASCII(byte(r)))
+		}
+	case FoldUnicode:
+		r = foldRune(r)
+	}
+	if m.runeMap != nil {
+		r = m.runeMap(r)
+	}
+	return r
+}
+
+// appendRewrite appends src rewritten by m to dst
+func (m *Matcher) appendRewrite(dst, src []byte) []byte {
+	for len(src) > 0 {
+		r, n := utf8.DecodeRune(src)
+		if r == utf8.RuneError && n == 1 {
+			dst = append(dst, src[0])
+		} else {
+			var enc [utf8.UTFMax]byte
+			dst = append(dst, enc[:utf8.EncodeRune(enc[:], m.mapRune(r))]...)
+		}
+		src = src[n:]
+	}
+	return dst
+}
+
+// segment returns the length of the next piece of pend which can be
+// rewritten on its own, or 0 if more input is needed
+func (m *Matcher) segment(pend []byte, final bool) int {
+	if !utf8.FullRune(pend) {
+		if final {
+			return 1
+		}
+		return 0
+	}
+	_, n := utf8.DecodeRune(pend)
+	if m.norm&NormNFKC == 0 {
+		return n
+	}
+	if k := norm.NFKC.FirstBoundary(pend[n:]); k >= 0 {
+		return n + k
+	}
+	if final || len(pend) >= norm.MaxSegmentSize {
+		return len(pend)
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package cedar
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		mode  NormMode
+		words []string
+		seq   string
+		want  string
+	}{
+		{NormNFKC, []string{"％", "±", "50%"}, "５０％ ±1", "[8:５０％ 8:％ 11:±]"},
+		{NormNFKC, []string{"caf\u00e9"}, "cafe\u0301 caf\u00e9", "[5:cafe\u0301 11:caf\u00e9]"},
+		{NormWidth, []string{"ABC", "カタカナ"}, "ＡＢＣ ｶﾀｶﾅ", "[8:ＡＢＣ 21:ｶﾀｶﾅ]"},
+		{NormNFKC | NormWidth, []string{"ｶﾞ"}, "ガ ｶﾞ", "[2:ガ 9:ｶﾞ]"},
+	}
+	for _, c := range cases {
+		m := NewMatcher(WithNormalize(c.mode))
+		for i, w := range c.words {
+			m.Insert([]byte(w), i)
+		}
+		if got := fmt.Sprint(collect(m, []byte(c.seq))); got != c.want {
+			t.Errorf("mode %d seq %q: got %s, want %s", c.mode, c.seq, got, c.want)
+		}
+	}
+}
+
+func TestRuneMap(t *testing.T) {
+	t2s := map[rune]rune{'國': '国', '華': '华'}
+	m := NewMatcher(WithNormalize(NormNFKC), WithFold(FoldUnicode), WithRuneMap(func(r rune) rune {
+		if s, ok := t2s[r]; ok {
+			return s
+		}
+		return r
+	}))
+	m.Insert([]byte("中华民国"), 0)
+	m.Insert([]byte("ＵＳＡ"), 1)
+	seq := []byte("中華民國 usa")
+	want := "[11:中華民國 15:usa]"
+	if got := fmt.Sprint(collect(m, seq)); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package cedar
+
+import (
+	"runtime"
+	"sync"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// parallelMinSegment is the smallest segment of input matched by a goroutine
+const parallelMinSegment = 64 << 10
+
+// ParallelMatch is like Match, but splits a large seq into segments matched
+// concurrently by up to workers goroutines, GOMAXPROCS if workers <= 0.
+// Segments overlap by the length of the longest key - 1, matches found in
+// both segments are kept once, and the response is the one of Match.
+// Segments stop at the limits of opts, so that no more matches are
+// buffered than a response can hold. Matchers rewriting their input,
+// and leftmost matchers with whole word keys, match sequentially.
+func (m *Matcher) ParallelMatch(seq []byte, workers int, opts ...MatchOption) *Response {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	n := min(workers, len(seq)/parallelMinSegment)
+	if n <= 1 || !m.ready() || m.rewrites() || m.leftmost() && m.hasWords {
+		return m.Match(seq, opts...)
+	}
+	return m.parallelMatch(seq, splitSeq(seq, n), opts...)
+}
+
+// splitSeq returns the bounds of n segments of seq, starting at runes
+func splitSeq(seq []byte, n int) []int {
+	bounds := make([]int, n+1)
+	for k := 1; k < n; k++ {
+		b := max(k*len(seq)/n, bounds[k-1])
+		for b < len(seq) && !utf8.RuneStart(seq[b]) {
+			b++
+		}
+		bounds[k] = b
+	}
+	bounds[n] = len(seq)
+	return bounds
+}
+
+// parallelMatch matches the segments of seq between bounds concurrently
+func (m *Matcher) parallelMatch(seq []byte, bounds []int, opts ...MatchOption) *Response {
+	resp := NewResponse(m)
+	for _, opt := range opts {
+		opt(&resp.limits)
+	}
+	segs := make([]segment, len(bounds)-1)
+	var wg sync.WaitGroup
+	for k := range segs {
+		segs[k].l = resp.limits
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.matchSegment(seq, bounds[k], bounds[k+1], &segs[k])
+		}()
+	}
+	wg.Wait()
+	if m.leftmost() {
+		m.stitch(seq, bounds, segs)
+	}
+
+	for _, seg := range segs {
+		for _, at := range seg.at {
+			if resp.add(at); resp.truncated {
+				return resp
+			}
+		}
+	}
+	return resp
+}
+
+// segment holds the matches owned by a segment, up to the first one
+// exceeding the limits of the response, in which case it is cut and
+// the response is truncated while merging it
+type segment struct {
+	l     matchLimits
+	at    []matchAt
+	words int
+	cut   bool
+}
+
+// add appends at and tells whether there is room for more matches
+func (s *segment) add(m *Matcher, at matchAt) bool {
+	s.at = append(s.at, at)
+	if s.l.maxMatches > 0 {
+		s.words += m.outputsOf(at)
+	}
+	s.cut = s.l.maxBytes > 0 && len(s.at)*int(unsafe.Sizeof(at)) > s.l.maxBytes ||
+		s.l.maxMatches > 0 && s.words > s.l.maxMatches
+	return !s.cut
+}
+
+// matchSegment adds to seg the matches owned by seq[from:to]: the ones
+// ending in it, or for leftmost kinds the ones starting in it when walking
+// from from. The walk starts and ends one rune further for boundary flags,
+// which agree with a walk of the whole seq after one rune.
+func (m *Matcher) matchSegment(seq []byte, from, to int, seg *segment) {
+	pad := 0
+	if m.runeSafe || m.hasWords {
+		pad = utf8.UTFMax
+	}
+	if m.leftmost() {
+		end := min(len(seq), to+m.maxLen-1+pad)
+		m.walk(seq[from:end], func(at matchAt) bool {
+			at.At += from
+			if at.At-m.da.vals[at.VKey].Len+1 >= to {
+				return false
+			}
+			return seg.add(m, at)
+		})
+		return
+	}
+	start := max(0, from-m.maxLen+1-pad)
+	end := min(len(seq), to+pad)
+	m.walk(seq[start:end], func(at matchAt) bool {
+		at.At += start
+		if at.At >= to {
+			return false
+		}
+		if at.At >= from {
+			return seg.add(m, at)
+		}
+		return true
+	})
+}
+
+// walk emits matches of seq in order, until emit returns false
+func (m *Matcher) walk(seq []byte, emit func(matchAt) bool) {
+	if m.plain(m.kind) {
+		nid := 0
+		for i, b := range seq {
+			nid = m.next(nid, b)
+			if nid != 0 && m.da.isEnd(nid) && !emit(matchAt{OutID: nid, At: i}) {
+				return
+			}
+		}
+		return
+	}
+	stop := false
+	w := newWalker(m, m.kind, func(at matchAt) {
+		if !stop {
+			stop = !emit(at)
+		}
+	})
+	for _, b := range seq {
+		if stop {
+			return
+		}
+		w.feed(b)
+	}
+	w.flush()
+}
+
+// stitch fixes leftmost matches of segments walked from their start
+// while the last match of the previous segment ends past it. Segments
+// after a cut one are not merged and are left as they are.
+func (m *Matcher) stitch(seq []byte, bounds []int, segs []segment) {
+	resume := 0
+	for k := range segs {
+		if resume > bounds[k] {
+			m.resync(seq, resume, bounds[k+1], &segs[k])
+		}
+		seg := &segs[k]
+		if seg.cut {
+			return
+		}
+		if len(seg.at) > 0 {
+			resume = seg.at[len(seg.at)-1].At + 1
+		}
+	}
+}
+
+// resync walks seq from resume and replaces the matches of seg by the
+// ones starting before to. Those of seg are taken as soon as both walks
+// settle the same match, unless seg is cut: it may end short of to.
+func (m *Matcher) resync(seq []byte, resume, to int, seg *segment) {
+	old := seg.at
+	adopt := !seg.cut
+	*seg = segment{l: seg.l}
+	j := 0
+	m.walk(seq[resume:], func(at matchAt) bool {
+		at.At += resume
+		if at.At-m.da.vals[at.VKey].Len+1 >= to {
+			return false
+		}
+		for j < len(old) && old[j].At < at.At {
+			j++
+		}
+		if adopt && j < len(old) && old[j] == at {
+			// both walks restart right after at
+			seg.at = append(seg.at, old[j:]...)
+			return false
+		}
+		return seg.add(m, at)
+	})
+}
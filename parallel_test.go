@@ -0,0 +1,81 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestParallelMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "c", " ", "é", "\xa9", "語"}
+	gen := func(n int) []byte {
+		var b []byte
+		for len(b) < n {
+			b = append(b, alphabet[r.Intn(len(alphabet))]...)
+		}
+		return b
+	}
+	kinds := []MatchKind{MatchOverlapping, MatchLeftmostFirst, MatchLeftmostLongest, MatchLongestPerEnd}
+	options := [][]MatcherOption{nil, {WithRuneSafe()}, {WithWholeWords()}}
+	for round := 0; round < 100; round++ {
+		var words [][]byte
+		for i := 0; i < 8; i++ {
+			words = append(words, gen(1+r.Intn(6)))
+		}
+		seq := gen(300)
+		for _, kind := range kinds {
+			for o, opts := range options {
+				m := NewMatcher(append(opts, WithMatchKind(kind))...)
+				for i, w := range words {
+					m.Insert(w, i)
+				}
+				if m.Compile(); m.leftmost() && m.hasWords {
+					continue
+				}
+				want := fmt.Sprint(spans(m, seq))
+				for _, n := range []int{2, 7, 40, 150} {
+					if got := fmt.Sprint(spansOf(m.parallelMatch(seq, splitSeq(seq, n)), seq)); got != want {
+						t.Fatalf("kind %d options %d words %q seq %q in %d: got %s\nwant %s", kind, o, words, seq, n, got, want)
+					}
+				}
+				for l, lim := range [][]MatchOption{{WithMaxMatches(5)}, {WithMaxBufferedBytes(7 * 24)}} {
+					want := m.Match(seq, lim...)
+					resp := m.parallelMatch(seq, splitSeq(seq, 7), lim...)
+					if resp.Truncated() != want.Truncated() || fmt.Sprint(spansOf(resp, seq)) != fmt.Sprint(spansOf(want, seq)) {
+						t.Fatalf("kind %d options %d limits %d words %q seq %q: limits differ from Match", kind, o, l, words, seq)
+					}
+				}
+			}
+		}
+	}
+
+	m := NewMatcher(WithMatchKind(MatchLeftmostLongest))
+	for i, key := range []string{"he", "her", "hers", "she"} {
+		m.Insert([]byte(key), i)
+	}
+	seq := bytes.Repeat([]byte("ushers "), 4*parallelMinSegment/7)
+	if got, want := fmt.Sprint(spansOf(m.ParallelMatch(seq, 4), seq)), fmt.Sprint(spans(m, seq)); got != want {
+		t.Error("ParallelMatch differs from Match")
+	}
+	resp := m.ParallelMatch(seq, 4, WithMaxMatches(10))
+	if !resp.Truncated() || len(spansOf(resp, seq)) != 10 {
+		t.Error("ParallelMatch ignores match limits")
+	}
+
+	// segments stop at the limits instead of buffering every match
+	m = NewMatcher()
+	for n := 1; n <= 64; n++ {
+		m.Insert(bytes.Repeat([]byte("a"), n), n)
+	}
+	m.Compile()
+	seq = bytes.Repeat([]byte("a"), 1<<20)
+	seg := segment{l: matchLimits{maxMatches: 10}}
+	if m.matchSegment(seq, 0, len(seq), &seg); !seg.cut || len(seg.at) > 11 {
+		t.Errorf("segment of %d matches, cut %v", len(seg.at), seg.cut)
+	}
+	if got, want := fmt.Sprint(spansOf(m.ParallelMatch(seq, 4, WithMaxMatches(10)), seq)), fmt.Sprint(spansOf(m.Match(seq, WithMaxMatches(10)), seq)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
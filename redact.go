@@ -0,0 +1,135 @@
+package cedar
+
+import (
+	"bytes"
+	"io"
+)
+
+// MaskFixed returns a replacement function masking every key with mask,
+// see NewReplacerFunc
+func MaskFixed(mask string) func(key []byte, value interface{}) []byte {
+	return func(key []byte, value interface{}) []byte {
+		return []byte(mask)
+	}
+}
+
+// MaskStars masks every byte of key with '*', see NewReplacerFunc
+func MaskStars(key []byte, value interface{}) []byte {
+	return bytes.Repeat([]byte{'*'}, len(key))
+}
+
+// Redactor is an io.WriteCloser writing to an underlying writer with the
+// replacements of a Replacer, e.g. to mask sensitive words of logs.
+// Matches spanning several writes are replaced: the bytes which may still
+// be part of a match are held back, at most MaxLen()-1 bytes, and a few
+// more of the last runes with whole word keys or rewriting matchers.
+// Close writes them. Each byte written walks back over the bytes held
+// back, up to MaxLen() steps on input running into a long key.
+// A Redactor is not safe for concurrent use.
+type Redactor struct {
+	r     *Replacer
+	dst   io.Writer
+	w     *walker
+	f     feeder
+	fold  *folder
+	om    offsetMap
+	buf   []byte // input held back, from offset off
+	off   int
+	last  int // end of the last match
+	err   error
+	close bool
+}
+
+// NewRedactor returns a Redactor writing to w with the replacements of r.
+// Use NewReplacer for replacements stored as values, or NewReplacerFunc
+// with MaskFixed or MaskStars.
+func NewRedactor(w io.Writer, r *Replacer) *Redactor {
+	m := r.m
+	rd := &Redactor{r: r, dst: w, err: m.Compile()}
+	if rd.err != nil {
+		return rd
+	}
+	rd.w = newWalker(m, MatchLeftmostLongest, rd.replace)
+	rd.w.eager = true
+	rd.f = m.newFeeder(rd.w, &rd.om)
+	rd.fold, _ = rd.f.(*folder)
+	return rd
+}
+
+// Write writes p with replacements, matches which may continue in the
+// next writes are written later. It returns the first error of the
+// underlying writer, or of Compile.
+func (rd *Redactor) Write(p []byte) (n int, err error) {
+	if rd.close {
+		return 0, ErrClosed
+	}
+	if rd.err != nil {
+		return 0, rd.err
+	}
+	rd.buf = append(rd.buf, p...)
+	for _, b := range p {
+		rd.f.feed(b)
+	}
+	rd.write(rd.safe())
+	// drop written input
+	rd.buf = rd.buf[:copy(rd.buf, rd.buf[rd.last-rd.off:])]
+	rd.off = rd.last
+	if len(rd.om.spans) > DefaultMatchBufferSize {
+		rd.om.trim(rd.w.settled())
+	}
+	if rd.err != nil {
+		return 0, rd.err
+	}
+	return len(p), nil
+}
+
+// Close writes the bytes held back, it does not close the underlying writer
+func (rd *Redactor) Close() error {
+	if rd.close {
+		return nil
+	}
+	rd.close = true
+	if rd.err != nil {
+		return rd.err
+	}
+	rd.f.flush()
+	rd.write(rd.off + len(rd.buf))
+	return rd.err
+}
+
+// replace writes input up to the match at then its replacement
+func (rd *Redactor) replace(at matchAt) {
+	t := rd.r.m.token(at.At, rd.r.m.da.vals[at.VKey], &rd.om)
+	start, end := t.At-t.KLen+1, t.At+1
+	rd.write(start)
+	rd.emit(rd.r.replacement(rd.buf[start-rd.off:end-rd.off], t.Value))
+	rd.last = end
+}
+
+// write writes input from the end of the last match up to end
+func (rd *Redactor) write(end int) {
+	if end > rd.last {
+		rd.emit(rd.buf[rd.last-rd.off : end-rd.off])
+		rd.last = end
+	}
+}
+
+func (rd *Redactor) emit(p []byte) {
+	if rd.err == nil && len(p) > 0 {
+		_, rd.err = rd.dst.Write(p)
+	}
+}
+
+// safe returns the offset of input before which no byte can be part of
+// a match to come
+func (rd *Redactor) safe() int {
+	p := rd.w.settled()
+	if rd.fold == nil {
+		return p
+	}
+	if p < rd.w.fed+len(rd.w.ahead) {
+		start, _ := rd.om.locate(p)
+		return start
+	}
+	return rd.fold.orig
+}
@@ -0,0 +1,73 @@
+package cedar
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "A", " ", "é", "É", "語"}
+	gen := func(n int) []byte {
+		var b []byte
+		for len(b) < n {
+			b = append(b, alphabet[r.Intn(len(alphabet))]...)
+		}
+		return b
+	}
+	options := [][]MatcherOption{nil, {WithWholeWords()}, {WithFold(FoldUnicode)}, {WithNormalize(NormNFKC)}}
+	masks := []func(key []byte, value interface{}) []byte{nil, MaskStars, MaskFixed("[redacted]")}
+	for round := 0; round < 200; round++ {
+		seq := gen(300)
+		for o, opts := range options {
+			m := NewMatcher(opts...)
+			for i := 0; i < 8; i++ {
+				m.Insert(gen(1+r.Intn(6)), string(gen(r.Intn(4))))
+			}
+			for _, mask := range masks {
+				rp := NewReplacerFunc(m, mask)
+				var out bytes.Buffer
+				rd := NewRedactor(&out, rp)
+				for rest := seq; len(rest) > 0; {
+					n := min(r.Intn(8), len(rest))
+					if _, err := rd.Write(rest[:n]); err != nil {
+						t.Fatal(err)
+					}
+					if opts == nil && len(rd.buf) > m.MaxLen()-1 {
+						t.Fatalf("%d bytes held back", len(rd.buf))
+					}
+					rest = rest[n:]
+				}
+				if err := rd.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if got, want := out.String(), string(rp.Replace(seq)); got != want {
+					t.Fatalf("options %d seq %q: got %q\nwant %q", o, seq, got, want)
+				}
+			}
+		}
+	}
+
+	m := NewMatcher()
+	m.Insert([]byte("secret"), 0)
+	var out bytes.Buffer
+	rd := NewRedactor(&out, NewReplacerFunc(m, MaskStars))
+	rd.Write([]byte("a sec"))
+	rd.Write([]byte("ret b"))
+	if out.String() != "a ****** b" {
+		t.Errorf("got %q", out.String())
+	}
+	rd.Close()
+	if _, err := rd.Write([]byte("secret")); err != ErrClosed {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+
+	da := NewCedar()
+	da.Insert([]byte("he"), 0)
+	da.Insert([]byte("she"), 0)
+	m = NewMatcherFromCedar(da, WithCedarOptions(WithMaxKeys(1)))
+	if _, err := NewRedactor(&out, NewReplacer(m)).Write([]byte("she")); err != ErrTooLarge {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,100 @@
+package cedar
+
+import (
+	"bytes"
+	"io"
+)
+
+// Replacer rewrites matched keys of a Matcher, like strings.Replacer.
+// Matches are selected leftmost-longest whatever the MatchKind of the
+// Matcher is, and never overlap. It is safe for concurrent use once
+// the Matcher is compiled.
+type Replacer struct {
+	m  *Matcher
+	fn func(key []byte, value interface{}) []byte
+}
+
+// NewReplacer returns a Replacer using values of m as replacements,
+// values must be string or []byte, keys with other values are kept.
+func NewReplacer(m *Matcher) *Replacer {
+	return NewReplacerFunc(m, nil)
+}
+
+// NewReplacerFunc returns a Replacer calling fn for the replacement of
+// each matched key, key is the matched text of the input.
+func NewReplacerFunc(m *Matcher, fn func(key []byte, value interface{}) []byte) *Replacer {
+	m.Compile()
+	return &Replacer{m: m, fn: fn}
+}
+
+// Replace returns a copy of seq with all replacements performed,
+// or nil if the Matcher fails to compile
+func (r *Replacer) Replace(seq []byte) []byte {
+	out := bytes.NewBuffer(make([]byte, 0, len(seq)))
+	if _, err := r.WriteBytes(out, seq); err != nil {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// ReplaceString returns a copy of s with all replacements performed,
+// or "" if the Matcher fails to compile
+func (r *Replacer) ReplaceString(s string) string {
+	out := bytes.NewBuffer(make([]byte, 0, len(s)))
+	if _, err := r.WriteBytes(out, []byte(s)); err != nil {
+		return ""
+	}
+	return out.String()
+}
+
+// WriteString writes s to w with all replacements performed
+func (r *Replacer) WriteString(w io.Writer, s string) (n int, err error) {
+	return r.WriteBytes(w, []byte(s))
+}
+
+// WriteBytes writes seq to w with all replacements performed,
+// nothing is written if the Matcher fails to compile and its error is returned.
+func (r *Replacer) WriteBytes(w io.Writer, seq []byte) (n int, err error) {
+	m := r.m
+	if err := m.Compile(); err != nil {
+		return 0, err
+	}
+	var om offsetMap
+	last := 0
+	write := func(p []byte) {
+		if err == nil {
+			var c int
+			c, err = w.Write(p)
+			n += c
+		}
+	}
+	f := m.newFeeder(newWalker(m, MatchLeftmostLongest, func(at matchAt) {
+		t := m.token(at.At, m.da.vals[at.VKey], &om)
+		start := t.At - t.KLen + 1
+		write(seq[last:start])
+		write(r.replacement(seq[start:t.At+1], t.Value))
+		last = t.At + 1
+	}), &om)
+	for _, b := range seq {
+		f.feed(b)
+		if err != nil {
+			return n, err
+		}
+	}
+	f.flush()
+	write(seq[last:])
+	return n, err
+}
+
+func (r *Replacer) replacement(key []byte, value interface{}) []byte {
+	if r.fn != nil {
+		return r.fn(key, value)
+	}
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return key
+}
@@ -0,0 +1,42 @@
+package cedar
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReplacer(t *testing.T) {
+	m := NewMatcher(WithFold(FoldASCII))
+	m.Insert([]byte("he"), "HE")
+	m.Insert([]byte("hers"), []byte("THEIRS"))
+	m.Insert([]byte("she"), 3)
+	r := NewReplacer(m)
+	// "she" starts before "hers" in "ushers", its value is not a string
+	if got, want := r.ReplaceString("Hers she ushers he"), "THEIRS she ushers HE"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	r = NewReplacerFunc(m, func(key []byte, value interface{}) []byte {
+		return bytes.Repeat([]byte("*"), len(key))
+	})
+	if got, want := string(r.Replace([]byte("Hers she ushers he"))), "**** *** u***rs **"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	var out strings.Builder
+	n, err := r.WriteString(&out, "no match")
+	if err != nil || n != len("no match") || out.String() != "no match" {
+		t.Errorf("got %q %d %v", out.String(), n, err)
+	}
+}
+
+func TestReplacerFold(t *testing.T) {
+	// keys shrink after folding, replacements use original offsets
+	m := NewMatcher(WithNormalize(NormNFKC))
+	m.Insert([]byte("abc"), "x")
+	r := NewReplacer(m)
+	if got, want := r.ReplaceString("1ａｂｃ2abc3"), "1x2x3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package cedar
+
+// WithRuneSafe only reports words starting and ending on utf-8 rune
+// boundaries of the input, and fills rune and utf-16 offsets of MatchToken.
+func WithRuneSafe() MatcherOption {
+	return func(m *Matcher) {
+		m.runeSafe = true
+	}
+}
+
+// runeStep returns the number of runes and utf-16 units started by b
+func runeStep(b byte) (runes, u16 int) {
+	switch {
+	case b&0xC0 == 0x80:
+		return 0, 0
+	case b >= 0xF0:
+		return 1, 2
+	}
+	return 1, 1
+}
+
+// runeCounter counts runes and utf-16 units of input up to pos
+type runeCounter struct {
+	pos, runes, u16 int
+}
+
+func (rc *runeCounter) reset() {
+	*rc = runeCounter{}
+}
+
+// advance counts bytes of seq up to end
+func (rc *runeCounter) advance(seq []byte, end int) {
+	for ; rc.pos < end; rc.pos++ {
+		r, u := runeStep(seq[rc.pos])
+		rc.runes += r
+		rc.u16 += u
+	}
+}
+
+// fill sets rune offsets of t, the counter must be right after the key
+func (rc *runeCounter) fill(t *MatchToken, key []byte) {
+	t.RuneLen, t.UTF16Len = 0, 0
+	for _, b := range key {
+		r, u := runeStep(b)
+		t.RuneLen += r
+		t.UTF16Len += u
+	}
+	t.RuneStart = rc.runes - t.RuneLen
+	t.UTF16Start = rc.u16 - t.UTF16Len
+}
+
+// fillRunes sets rune offsets of tokens ending at the same position of seq
+func (rc *runeCounter) fillRunes(seq []byte, tokens []MatchToken) {
+	for i := range tokens {
+		t := &tokens[i]
+		if t.At >= len(seq) {
+			return
+		}
+		rc.advance(seq, t.At+1)
+		rc.fill(t, seq[t.At-t.KLen+1:t.At+1])
+	}
+}
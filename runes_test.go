@@ -0,0 +1,66 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRuneSafe(t *testing.T) {
+	// "\xad\xe6" is the tail of "中" and the head of "文"
+	words := []string{"\xad\xe6", "文", "abc"}
+	seq := []byte("中文")
+	for _, safe := range []bool{false, true} {
+		var opts []MatcherOption
+		if safe {
+			opts = append(opts, WithRuneSafe())
+		}
+		m := NewMatcher(opts...)
+		for i, w := range words {
+			m.Insert([]byte(w), i)
+		}
+		got := fmt.Sprint(spans(m, seq))
+		want := "[2-3 3-5]"
+		if safe {
+			want = "[3-5]"
+		}
+		if got != want {
+			t.Errorf("safe %v: got %s, want %s", safe, got, want)
+		}
+	}
+}
+
+func TestRuneOffsets(t *testing.T) {
+	seq := []byte("héllo 世界😀abc 界")
+	want := "[界:7,1,7,1 abc:9,3,10,3 界:13,1,14,1]"
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostLongest} {
+		m := NewMatcher(WithRuneSafe(), WithMatchKind(kind))
+		m.Insert([]byte("界"), 0)
+		m.Insert([]byte("abc"), 1)
+		m.Compile()
+
+		var got []string
+		resp := m.Match(seq)
+		for resp.HasNext() {
+			for _, itr := range resp.NextMatchItem(seq) {
+				got = append(got, fmt.Sprintf("%s:%d,%d,%d,%d", m.Key(seq, itr), itr.RuneStart, itr.RuneLen, itr.UTF16Start, itr.UTF16Len))
+			}
+		}
+		resp.Release()
+		if fmt.Sprint(got) != want {
+			t.Errorf("kind %d: got %v, want %s", kind, got, want)
+		}
+
+		got = got[:0]
+		s := m.NewScanner(iotest.OneByteReader(bytes.NewReader(seq)))
+		for s.Scan() {
+			for _, itr := range s.Tokens() {
+				got = append(got, fmt.Sprintf("%s:%d,%d,%d,%d", s.Key(itr), itr.RuneStart, itr.RuneLen, itr.UTF16Start, itr.UTF16Len))
+			}
+		}
+		if fmt.Sprint(got) != want {
+			t.Errorf("kind %d: scanner got %v, want %s", kind, got, want)
+		}
+	}
+}
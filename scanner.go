@@ -0,0 +1,153 @@
+package cedar
+
+import (
+	"context"
+	"io"
+)
+
+// Scanner matches words of a compiled Matcher against an io.Reader.
+// The automaton state is carried across reads, so words that straddle
+// two chunks are still reported. Only a window of the last bytes of the
+// stream, a few times MaxLen(), is kept for key extraction.
+type Scanner struct {
+	m       *Matcher
+	r       io.Reader
+	ctx     context.Context
+	w       *walker
+	f       feeder
+	om      offsetMap
+	rc      runeCounter
+	buf     []byte
+	off, n  int
+	pos     int
+	win     []byte
+	ats     []matchAt
+	tokens  []MatchToken
+	err     error
+	flushed bool
+}
+
+// NewScanner returns a Scanner reading from r, the error of Compile
+// is returned by Err.
+func (m *Matcher) NewScanner(r io.Reader) *Scanner {
+	return m.NewScannerContext(context.Background(), r)
+}
+
+// NewScannerContext returns a Scanner reading from r until ctx is done,
+// the context is checked before each read and ctx.Err() is returned by Err.
+func (m *Matcher) NewScannerContext(ctx context.Context, r io.Reader) *Scanner {
+	err := m.Compile()
+	s := &Scanner{
+		m:   m,
+		r:   r,
+		ctx: ctx,
+		buf: make([]byte, DefaultTokenBufferSize),
+	}
+	s.w = newWalker(m, m.kind, func(at matchAt) {
+		s.ats = append(s.ats, at)
+	})
+	s.win = make([]byte, m.origLen(s.w.window()))
+	s.f = m.newFeeder(s.w, &s.om)
+	if err != nil {
+		s.err, s.flushed = err, true
+	}
+	return s
+}
+
+// Scan advances to the next stream position where words end.
+// It returns false at the end of the stream or on a read error.
+func (s *Scanner) Scan() bool {
+	for {
+		if len(s.ats) > 0 {
+			at, n := s.ats[0].At, 0
+			s.tokens = s.tokens[:0]
+			for ; n < len(s.ats) && s.ats[n].At == at; n++ {
+				s.tokens = s.m.appendTokens(s.tokens, s.ats[n], &s.om)
+			}
+			s.ats = s.ats[:copy(s.ats, s.ats[n:])]
+			if s.m.runeSafe {
+				for i := range s.tokens {
+					s.fillRunes(&s.tokens[i])
+				}
+			}
+			if len(s.tokens) > 0 {
+				return true
+			}
+			continue
+		}
+		if len(s.om.spans) > DefaultMatchBufferSize {
+			s.om.trim(s.w.settled())
+		}
+		for s.off < s.n && len(s.ats) == 0 {
+			b := s.buf[s.off]
+			s.off++
+			s.win[s.pos%len(s.win)] = b
+			s.pos++
+			r, u := runeStep(b)
+			s.rc.runes += r
+			s.rc.u16 += u
+			s.f.feed(b)
+		}
+		if len(s.ats) > 0 {
+			continue
+		}
+		if s.err != nil {
+			if s.flushed {
+				return false
+			}
+			s.flushed = true
+			s.f.flush()
+			continue
+		}
+		if err := s.ctx.Err(); err != nil {
+			s.err, s.flushed = err, true
+			continue
+		}
+		s.off = 0
+		s.n, s.err = s.r.Read(s.buf)
+	}
+}
+
+// Tokens returns words ending at the current position,
+// At of each token is the absolute offset in the stream.
+func (s *Scanner) Tokens() []MatchToken {
+	return s.tokens
+}
+
+// Key returns a copy of the matched key of t,
+// or nil if the key has already left the window.
+func (s *Scanner) Key(t MatchToken) []byte {
+	start := t.At - t.KLen + 1
+	if t.At >= s.pos || start < 0 || start < s.pos-len(s.win) {
+		return nil
+	}
+	key := make([]byte, t.KLen)
+	for i := range key {
+		key[i] = s.win[(start+i)%len(s.win)]
+	}
+	return key
+}
+
+// fillRunes sets rune offsets of t from the counts of consumed bytes
+func (s *Scanner) fillRunes(t *MatchToken) {
+	rc := s.rc
+	for p := t.At + 1; p < s.pos; p++ {
+		r, u := runeStep(s.win[p%len(s.win)])
+		rc.runes -= r
+		rc.u16 -= u
+	}
+	rc.fill(t, s.Key(*t))
+}
+
+// Offset returns the number of bytes consumed from the stream
+func (s *Scanner) Offset() int {
+	return s.pos
+}
+
+// Err returns the first non-EOF error encountered by the Scanner
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
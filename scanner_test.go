@@ -0,0 +1,72 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func collect(m *Matcher, seq []byte) []string {
+	var res []string
+	resp := m.Match(seq)
+	for resp.HasNext() {
+		for _, itr := range resp.NextMatchItem(seq) {
+			res = append(res, fmt.Sprintf("%d:%s", itr.At, m.Key(seq, itr)))
+		}
+	}
+	resp.Release()
+	return res
+}
+
+func TestScanner(t *testing.T) {
+	words := []string{
+		"she", "he", "her", "hers", "中华人民", "人民",
+	}
+	seq := []byte("hershertongher中华人民共和国ushers")
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostFirst, MatchLeftmostLongest, MatchLongestPerEnd} {
+		m := NewMatcher(WithMatchKind(kind))
+		for i, word := range words {
+			m.Insert([]byte(word), i)
+		}
+		m.Compile()
+		want := collect(m, seq)
+
+		s := m.NewScanner(iotest.OneByteReader(bytes.NewReader(seq)))
+		var got []string
+		for s.Scan() {
+			for _, itr := range s.Tokens() {
+				got = append(got, fmt.Sprintf("%d:%s", itr.At, s.Key(itr)))
+			}
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("kind %d: got %v, want %v", kind, got, want)
+		}
+		if s.Offset() != len(seq) {
+			t.Fatalf("offset %d, want %d", s.Offset(), len(seq))
+		}
+	}
+}
+
+func TestScannerRewritten(t *testing.T) {
+	// width folding keeps 3 byte runes of the input for 1 byte of keys
+	m := NewMatcher(WithFold(FoldASCII), WithNormalize(NormWidth))
+	m.Insert([]byte("abcd"), 0)
+	s := m.NewScanner(iotest.OneByteReader(strings.NewReader("ａａａａａａａａａａａｂｃｄ")))
+	var got []string
+	for s.Scan() {
+		for _, itr := range s.Tokens() {
+			got = append(got, fmt.Sprintf("%d:%d:%s", itr.At, itr.KLen, s.Key(itr)))
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[41:12:ａｂｃｄ]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
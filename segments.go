@@ -0,0 +1,61 @@
+package cedar
+
+import "sort"
+
+// SegmentPos is the position of byte Off of segment Seg in fragmented input
+type SegmentPos struct {
+	Seg, Off int
+}
+
+// SegmentMatch is a match in fragmented input, see MatchSegments.
+// Start and End are offsets in the whole input, the key is input[Start:End].
+// First and Last are the positions of the first and last bytes of the key.
+type SegmentMatch struct {
+	Start, End  int
+	First, Last SegmentPos
+	Value       interface{}
+}
+
+// MatchSegments returns matches in the concatenation of segs, e.g. of
+// net.Buffers, in the order of Match, without concatenating them.
+// Keys may span several segments, see SegmentKey.
+func (m *Matcher) MatchSegments(segs [][]byte) []SegmentMatch {
+	if !m.ready() {
+		return nil
+	}
+	// offsets of the ends of segments
+	ends := make([]int, len(segs))
+	n := 0
+	for i, seg := range segs {
+		n += len(seg)
+		ends[i] = n
+	}
+	locate := func(p int) SegmentPos {
+		i := sort.SearchInts(ends, p+1)
+		return SegmentPos{Seg: i, Off: p - ends[i] + len(segs[i])}
+	}
+	var res []SegmentMatch
+	m.matchFragments(segs, m.kind, func(start, end, vk int) bool {
+		res = append(res, SegmentMatch{
+			Start: start, End: end,
+			First: locate(start), Last: locate(end - 1),
+			Value: m.da.vals[vk].Value,
+		})
+		return true
+	})
+	return res
+}
+
+// SegmentKey returns the key of mt in segs, a slice of segs if the key is
+// in one segment, or else a copy of its parts
+func (m *Matcher) SegmentKey(segs [][]byte, mt SegmentMatch) []byte {
+	if mt.First.Seg == mt.Last.Seg {
+		return segs[mt.First.Seg][mt.First.Off : mt.Last.Off+1]
+	}
+	key := make([]byte, 0, mt.End-mt.Start)
+	key = append(key, segs[mt.First.Seg][mt.First.Off:]...)
+	for i := mt.First.Seg + 1; i < mt.Last.Seg; i++ {
+		key = append(key, segs[i]...)
+	}
+	return append(key, segs[mt.Last.Seg][:mt.Last.Off+1]...)
+}
@@ -0,0 +1,60 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "A", " ", "é", "語"}
+	gen := func(n int) []byte {
+		var b []byte
+		for len(b) < n {
+			b = append(b, alphabet[r.Intn(len(alphabet))]...)
+		}
+		return b
+	}
+	options := [][]MatcherOption{
+		nil,
+		{WithMatchKind(MatchLeftmostLongest)},
+		{WithMatchKind(MatchLongestPerEnd), WithWholeWords()},
+		{WithFold(FoldUnicode), WithRuneSafe()},
+	}
+	for round := 0; round < 100; round++ {
+		seq := gen(200)
+		var segs [][]byte
+		for rest := seq; len(rest) > 0; {
+			n := min(r.Intn(6), len(rest))
+			segs = append(segs, rest[:n])
+			rest = rest[n:]
+		}
+		for o, opts := range options {
+			m := NewMatcher(opts...)
+			for i := 0; i < 8; i++ {
+				m.Insert(gen(1+r.Intn(6)), i)
+			}
+			var got []string
+			for _, mt := range m.MatchSegments(segs) {
+				key := m.SegmentKey(segs, mt)
+				if !bytes.Equal(key, seq[mt.Start:mt.End]) || len(segs[mt.First.Seg]) <= mt.First.Off || len(segs[mt.Last.Seg]) <= mt.Last.Off {
+					t.Fatalf("options %d: key %q of %+v in %q", o, key, mt, seq)
+				}
+				got = append(got, fmt.Sprintf("%d-%d:%v", mt.Start, mt.End, mt.Value))
+			}
+			if fmt.Sprint(got) != values(m, seq) {
+				t.Fatalf("options %d: got %v\nwant %s", o, got, values(m, seq))
+			}
+		}
+	}
+
+	m := NewMatcher()
+	m.Insert([]byte("hers"), 0)
+	segs := [][]byte{[]byte("ush"), nil, []byte("e"), []byte("rs")}
+	mt := m.MatchSegments(segs)
+	if len(mt) != 1 || mt[0].First != (SegmentPos{0, 2}) || mt[0].Last != (SegmentPos{3, 1}) || string(m.SegmentKey(segs, mt[0])) != "hers" {
+		t.Errorf("got %+v", mt)
+	}
+}
@@ -0,0 +1,338 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"iter"
+)
+
+// TypedMatch is a match with a value of type V, see Match
+type TypedMatch[V any] struct {
+	Start, End int
+	Key        []byte
+	Value      V
+}
+
+// typedValues stores values of type V unboxed, indexed by value key
+type typedValues[V any] []V
+
+func (tv *typedValues[V]) set(vk int, value V) {
+	if vk >= len(*tv) {
+		*tv = append(*tv, make([]V, vk+1-len(*tv))...)
+	}
+	(*tv)[vk] = value
+}
+
+func (tv typedValues[V]) get(vk int) (value V) {
+	if vk < len(tv) {
+		value = tv[vk]
+	}
+	return value
+}
+
+// replace sets the value of value key vk, and clears the value of old,
+// the value key of a key inserted again
+func (tv *typedValues[V]) replace(old, vk int, value V) {
+	if old != 0 {
+		var zero V
+		tv.set(old, zero)
+	}
+	tv.set(vk, value)
+}
+
+// TypedCodec encodes and decodes values of type V in the binary format,
+// see TypedMatcher.Encode
+type TypedCodec[V any] interface {
+	EncodeValue(v V) ([]byte, error)
+	DecodeValue(data []byte) (V, error)
+}
+
+// TypedGobCodec returns a TypedCodec encoding values with encoding/gob
+func TypedGobCodec[V any]() TypedCodec[V] {
+	return typedGobCodec[V]{}
+}
+
+// TypedJSONCodec returns a TypedCodec encoding values with encoding/json
+func TypedJSONCodec[V any]() TypedCodec[V] {
+	return typedJSONCodec[V]{}
+}
+
+type typedGobCodec[V any] struct{}
+
+func (typedGobCodec[V]) EncodeValue(v V) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&v)
+	return buf.Bytes(), err
+}
+
+func (typedGobCodec[V]) DecodeValue(data []byte) (v V, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+type typedJSONCodec[V any] struct{}
+
+func (typedJSONCodec[V]) EncodeValue(v V) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (typedJSONCodec[V]) DecodeValue(data []byte) (v V, err error) {
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// encode returns the value encoder of Cedar.encode for codec
+func (tv typedValues[V]) encode(codec TypedCodec[V]) func(k int, v interface{}) ([]byte, error) {
+	if codec == nil {
+		codec = TypedGobCodec[V]()
+	}
+	return func(k int, v interface{}) ([]byte, error) {
+		return codec.EncodeValue(tv.get(k))
+	}
+}
+
+// decode returns the value decoder of decodeCedar for codec,
+// which stores values into tv
+func (tv *typedValues[V]) decode(codec TypedCodec[V]) func(k int, data []byte) (interface{}, error) {
+	if codec == nil {
+		codec = TypedGobCodec[V]()
+	}
+	return func(k int, data []byte) (interface{}, error) {
+		v, err := codec.DecodeValue(data)
+		tv.set(k, v)
+		return nil, err
+	}
+}
+
+// TypedCedar is a Cedar with values of type V, stored unboxed.
+// Values of the underlying Cedar are nil, see TypedMatcher.
+// Encode and DecodeTypedCedar save and load typed values.
+type TypedCedar[V any] struct {
+	da   *Cedar
+	vals typedValues[V]
+}
+
+// NewTypedCedar new a TypedCedar instance
+func NewTypedCedar[V any]() *TypedCedar[V] {
+	return &TypedCedar[V]{da: NewCedar()}
+}
+
+// Cedar returns the underlying cedar
+func (tc *TypedCedar[V]) Cedar() *Cedar {
+	return tc.da
+}
+
+// Insert adds a key-value pair into the cedar
+func (tc *TypedCedar[V]) Insert(key []byte, value V) error {
+	if err := tc.da.checkInsert(key); err != nil {
+		return err
+	}
+	old, _ := valueKey(tc.da, key)
+	tc.vals.replace(old, tc.da.insert(key, nil), value)
+	return nil
+}
+
+// Get returns the value associated with the given key,
+// it may return ErrNoPath or ErrNoValue.
+func (tc *TypedCedar[V]) Get(key []byte) (value V, err error) {
+	vk, err := valueKey(tc.da, key)
+	if err != nil {
+		return value, err
+	}
+	return tc.vals.get(vk), nil
+}
+
+// Delete removes a key-value pair from the cedar,
+// it will return ErrNoPath, if the key has not been added.
+func (tc *TypedCedar[V]) Delete(key []byte) error {
+	vk, err := valueKey(tc.da, key)
+	if err == ErrNoPath {
+		return err
+	}
+	if err == nil {
+		var zero V
+		tc.vals.set(vk, zero)
+	}
+	return tc.da.Delete(key)
+}
+
+// Encode writes the cedar to w in the binary format of Cedar.Encode,
+// values are encoded by codec, TypedGobCodec if nil.
+func (tc *TypedCedar[V]) Encode(w io.Writer, codec TypedCodec[V]) error {
+	var e encoder
+	if err := tc.da.encode(&e, tc.vals.encode(codec)); err != nil {
+		return err
+	}
+	return writeFrame(w, cedarMagic, e.buf)
+}
+
+// DecodeTypedCedar reads a cedar written by TypedCedar.Encode from r,
+// values are decoded by codec, TypedGobCodec if nil.
+func DecodeTypedCedar[V any](r io.Reader, codec TypedCodec[V]) (*TypedCedar[V], error) {
+	tc := &TypedCedar[V]{}
+	da, err := readCedar(r, tc.vals.decode(codec))
+	if err != nil {
+		return nil, err
+	}
+	tc.da = da
+	return tc, nil
+}
+
+// valueKey returns the value key of key in da,
+// it may return ErrNoPath or ErrNoValue.
+func valueKey(da *Cedar, key []byte) (int, error) {
+	to, err := da.Jump(key, 0)
+	if err != nil {
+		return 0, err
+	}
+	vk, err := da.vKeyOf(to)
+	if err != nil {
+		return 0, ErrNoValue
+	}
+	return vk, nil
+}
+
+// All returns an iterator over all keys of the cedar, ordered by keys
+func (tc *TypedCedar[V]) All() iter.Seq[TypedMatch[V]] {
+	return func(yield func(TypedMatch[V]) bool) {
+		da := tc.da
+		for from, err := da.begin(0); err == nil; from, err = da.next(from, 0) {
+			key, err := da.Key(from)
+			if err != nil {
+				continue
+			}
+			vk, err := da.vKeyOf(from)
+			if err != nil {
+				continue
+			}
+			if !yield(TypedMatch[V]{End: len(key), Key: key, Value: tc.vals.get(vk)}) {
+				return
+			}
+		}
+	}
+}
+
+// TypedMatcher is a Matcher with values of type V, stored unboxed in
+// a table of the TypedMatcher. Values of the underlying Matcher are nil:
+// save and load typed values by Encode and DecodeTypedMatcher, as
+// WriteTo and WriteFlat of Matcher() write nil values, and keys
+// inserted through Matcher() have zero values.
+type TypedMatcher[V any] struct {
+	m    *Matcher
+	vals typedValues[V]
+}
+
+// NewTypedMatcher new an aho corasick matcher with values of type V
+func NewTypedMatcher[V any](opts ...MatcherOption) *TypedMatcher[V] {
+	return &TypedMatcher[V]{m: NewMatcher(opts...)}
+}
+
+// Matcher returns the underlying matcher
+func (tm *TypedMatcher[V]) Matcher() *Matcher {
+	return tm.m
+}
+
+// Insert a key with its value, see Matcher.Insert
+func (tm *TypedMatcher[V]) Insert(key []byte, value V) error {
+	return tm.insert(key, value, tm.m.words.all)
+}
+
+// InsertWord inserts a whole word key with its value, see Matcher.InsertWord
+func (tm *TypedMatcher[V]) InsertWord(key []byte, value V) error {
+	return tm.insert(key, value, true)
+}
+
+func (tm *TypedMatcher[V]) insert(key []byte, value V, word bool) error {
+	old, _ := tm.vKey(key)
+	vk, err := tm.m.insert(key, nil, word)
+	if err == nil {
+		tm.vals.replace(old, vk, value)
+	}
+	return err
+}
+
+// Get returns the value of key, it may return ErrNoPath or ErrNoValue
+func (tm *TypedMatcher[V]) Get(key []byte) (value V, err error) {
+	vk, err := tm.vKey(key)
+	if err != nil {
+		return value, err
+	}
+	return tm.vals.get(vk), nil
+}
+
+// Delete removes a key and its value, see Matcher.Delete
+func (tm *TypedMatcher[V]) Delete(key []byte) error {
+	vk, err := tm.vKey(key)
+	if err != nil {
+		return ErrNoPath
+	}
+	if err := tm.m.Delete(key); err != nil {
+		return err
+	}
+	var zero V
+	tm.vals.set(vk, zero)
+	return nil
+}
+
+// vKey returns the value key of key, folded as inserted keys
+func (tm *TypedMatcher[V]) vKey(key []byte) (int, error) {
+	if tm.m.rewrites() {
+		key = tm.m.foldKey(key)
+	}
+	return valueKey(tm.m.da, key)
+}
+
+// Encode compiles the matcher if needed and writes it to w in the binary
+// format of Matcher.Encode, values are encoded by codec, TypedGobCodec
+// if nil.
+func (tm *TypedMatcher[V]) Encode(w io.Writer, codec TypedCodec[V]) error {
+	return tm.m.encode(w, tm.vals.encode(codec))
+}
+
+// DecodeTypedMatcher reads a matcher written by TypedMatcher.Encode from r,
+// values are decoded by codec, TypedGobCodec if nil. See DecodeMatcher.
+func DecodeTypedMatcher[V any](r io.Reader, codec TypedCodec[V], opts ...MatcherOption) (*TypedMatcher[V], error) {
+	tm := &TypedMatcher[V]{}
+	m, err := readMatcher(r, tm.vals.decode(codec), opts...)
+	if err != nil {
+		return nil, err
+	}
+	tm.m = m
+	return tm, nil
+}
+
+// Compile trie to aho-corasick, see Matcher.Compile
+func (tm *TypedMatcher[V]) Compile() error {
+	return tm.m.Compile()
+}
+
+// MatchFunc calls fn for every match in seq, seq[start:end] is the
+// matched key. It stops as soon as fn returns false.
+func (tm *TypedMatcher[V]) MatchFunc(seq []byte, fn func(start, end int, value V) bool) {
+	if !tm.m.ready() {
+		return
+	}
+	tm.m.matchKeys(seq, tm.m.kind, func(start, end, vk int) bool {
+		return fn(start, end, tm.vals.get(vk))
+	})
+}
+
+// All returns an iterator over matches in seq, see Matcher.All
+func (tm *TypedMatcher[V]) All(seq []byte) iter.Seq[TypedMatch[V]] {
+	return func(yield func(TypedMatch[V]) bool) {
+		tm.MatchFunc(seq, func(start, end int, value V) bool {
+			return yield(TypedMatch[V]{Start: start, End: end, Key: seq[start:end], Value: value})
+		})
+	}
+}
+
+// Match returns all matches in seq
+func (tm *TypedMatcher[V]) Match(seq []byte) []TypedMatch[V] {
+	var res []TypedMatch[V]
+	for mt := range tm.All(seq) {
+		res = append(res, mt)
+	}
+	return res
+}
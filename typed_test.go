@@ -0,0 +1,151 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTypedCedar(t *testing.T) {
+	tc := NewTypedCedar[float32]()
+	for i, word := range []string{"she", "hers", "her", "he"} {
+		tc.Insert([]byte(word), float32(i)+0.5)
+	}
+	if v, err := tc.Get([]byte("her")); err != nil || v != 2.5 {
+		t.Errorf("Get her got %v, %v", v, err)
+	}
+	if err := tc.Delete([]byte("her")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.Get([]byte("her")); err == nil {
+		t.Error("Get deleted key succeeded")
+	}
+	var got []string
+	for m := range tc.All() {
+		got = append(got, fmt.Sprintf("%s:%v", m.Key, m.Value))
+	}
+	if want := "[he:3.5 hers:1.5 she:0.5]"; fmt.Sprint(got) != want {
+		t.Errorf("All got %v, want %s", got, want)
+	}
+}
+
+func TestTypedMatcher(t *testing.T) {
+	type entry struct {
+		ID   int
+		Name string
+	}
+	for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostLongest} {
+		tm := NewTypedMatcher[entry](WithMatchKind(kind), WithFold(FoldASCII))
+		m := NewMatcher(WithMatchKind(kind), WithFold(FoldASCII))
+		for i, word := range []string{"she", "he", "her", "hers", " "} {
+			tm.Insert([]byte(word), entry{ID: i, Name: word})
+			m.Insert([]byte(word), i)
+		}
+		seq := []byte("usHershertongher")
+		var got, want []string
+		for _, mt := range tm.Match(seq) {
+			if !strings.EqualFold(mt.Value.Name, string(mt.Key)) {
+				t.Errorf("value %v of key %s", mt.Value, mt.Key)
+			}
+			got = append(got, fmt.Sprintf("%d-%d:%d", mt.Start, mt.End, mt.Value.ID))
+		}
+		for mt := range m.All(seq) {
+			want = append(want, fmt.Sprintf("%d-%d:%d", mt.Start, mt.End, mt.Value.(int)))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("kind %d: got %v, want %v", kind, got, want)
+		}
+
+		// updates of the compiled matcher
+		if v, err := tm.Get([]byte("HER")); err != nil || v.Name != "her" {
+			t.Errorf("kind %d: Get HER got %v, %v", kind, v, err)
+		}
+		if err := tm.Delete([]byte("her")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tm.Get([]byte("her")); err == nil {
+			t.Errorf("kind %d: Get deleted key succeeded", kind)
+		}
+		if err := tm.Delete([]byte("her")); err == nil {
+			t.Errorf("kind %d: Delete deleted key succeeded", kind)
+		}
+		tm.Insert([]byte("ton"), entry{ID: 5, Name: "ton"})
+		got = got[:0]
+		for _, mt := range tm.Match(seq) {
+			got = append(got, fmt.Sprintf("%d-%d:%s", mt.Start, mt.End, mt.Value.Name))
+		}
+		m.Delete([]byte("her"))
+		m.Insert([]byte("ton"), 5)
+		want = want[:0]
+		for mt := range m.All(seq) {
+			want = append(want, fmt.Sprintf("%d-%d:%s", mt.Start, mt.End, strings.ToLower(string(mt.Key))))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("kind %d: got %v after updates, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestTypedEncode(t *testing.T) {
+	type entry struct {
+		ID   int
+		Name string
+	}
+	tm := NewTypedMatcher[*entry](WithFold(FoldASCII))
+	for i, word := range []string{"she", "he", "her", "hers", "He"} {
+		tm.Insert([]byte(word), &entry{ID: i, Name: word})
+	}
+	// the value of a key inserted again is not kept alive
+	n := 0
+	for _, v := range tm.vals {
+		if v != nil {
+			n++
+		}
+	}
+	if n != 4 {
+		t.Errorf("%d values kept, want 4", n)
+	}
+
+	for _, codec := range []TypedCodec[*entry]{nil, TypedJSONCodec[*entry]()} {
+		var buf bytes.Buffer
+		if err := tm.Encode(&buf, codec); err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeTypedMatcher(&buf, codec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq := []byte("usHers")
+		var a, b []string
+		for _, mt := range tm.Match(seq) {
+			a = append(a, fmt.Sprintf("%d-%d:%v", mt.Start, mt.End, *mt.Value))
+		}
+		for _, mt := range got.Match(seq) {
+			b = append(b, fmt.Sprintf("%d-%d:%v", mt.Start, mt.End, *mt.Value))
+		}
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			t.Errorf("got %v, want %v", b, a)
+		}
+	}
+
+	tc := NewTypedCedar[float32]()
+	tc.Insert([]byte("she"), 1.5)
+	tc.Insert([]byte("she"), 2.5)
+	tc.Insert([]byte("he"), 3.5)
+	var buf bytes.Buffer
+	if err := tc.Encode(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	tc, err := DecodeTypedCedar[float32](&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for m := range tc.All() {
+		got = append(got, fmt.Sprintf("%s:%v", m.Key, m.Value))
+	}
+	if want := "[he:3.5 she:2.5]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
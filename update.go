@@ -0,0 +1,291 @@
+package cedar
+
+// revTree links every node to the nodes failing to it, in doubly linked
+// lists, so that links depending on a node can be found without a scan.
+// It is built on the first update of a compiled matcher.
+type revTree struct {
+	first, next, prev []int
+}
+
+func (t *revTree) push(parent, v int) {
+	t.prev[v], t.next[v] = -1, t.first[parent]
+	if t.first[parent] >= 0 {
+		t.prev[t.first[parent]] = v
+	}
+	t.first[parent] = v
+}
+
+func (t *revTree) remove(parent, v int) {
+	if t.prev[v] >= 0 {
+		t.next[t.prev[v]] = t.next[v]
+	} else {
+		t.first[parent] = t.next[v]
+	}
+	if t.next[v] >= 0 {
+		t.prev[t.next[v]] = t.prev[v]
+	}
+	t.prev[v], t.next[v] = -1, -1
+}
+
+// buildRev builds the reverse fail tree if needed
+func (m *Matcher) buildRev() {
+	if m.rev.first != nil {
+		return
+	}
+	n := len(m.fails)
+	m.rev = revTree{first: make([]int, n), next: make([]int, n), prev: make([]int, n)}
+	for i := range m.rev.first {
+		m.rev.first[i], m.rev.next[i], m.rev.prev[i] = -1, -1, -1
+	}
+	for v := 1; v < n; v++ {
+		if m.fails[v] >= 0 {
+			m.rev.push(m.fails[v], v)
+		}
+	}
+}
+
+// grow extends node tables to the size of the trie
+func (m *Matcher) grow() {
+	n := len(m.da.array)
+	for len(m.fails) < n {
+		m.fails = append(m.fails, -1)
+		m.rev.first = append(m.rev.first, -1)
+		m.rev.next = append(m.rev.next, -1)
+		m.rev.prev = append(m.rev.prev, -1)
+	}
+	m.depth = append(m.depth, make([]int, n-len(m.depth))...)
+	m.longest = append(m.longest, make([]int, n-len(m.longest))...)
+	m.outputs = append(m.outputs, make([]outNode, n-len(m.outputs))...)
+	if m.reversed {
+		m.first = append(m.first, make([]int, n-len(m.first))...)
+	}
+}
+
+// clear resets the tables of a released node
+func (m *Matcher) clear(v int) {
+	m.fails[v], m.depth[v], m.longest[v], m.outputs[v] = -1, 0, 0, outNode{}
+	m.rev.first[v], m.rev.next[v], m.rev.prev[v] = -1, -1, -1
+	if m.reversed {
+		m.first[v] = 0
+	}
+}
+
+// move follows the relocation of node from to node to in the trie
+func (m *Matcher) move(from, to int) {
+	m.grow()
+	t := &m.rev
+	m.fails[to], m.depth[to], m.longest[to], m.outputs[to] = m.fails[from], m.depth[from], m.longest[from], m.outputs[from]
+	m.da.info[to].End = m.da.info[from].End
+	if m.reversed {
+		m.first[to] = m.first[from]
+	}
+	if f := m.fails[from]; f >= 0 {
+		// take the place of from in the list of its fail node
+		t.prev[to], t.next[to] = t.prev[from], t.next[from]
+		if t.prev[to] >= 0 {
+			t.next[t.prev[to]] = to
+		} else {
+			t.first[f] = to
+		}
+		if t.next[to] >= 0 {
+			t.prev[t.next[to]] = to
+		}
+		t.first[to] = t.first[from]
+		for x := t.first[to]; x >= 0; x = t.next[x] {
+			m.fails[x] = to
+		}
+	}
+	m.clear(from)
+}
+
+// setFail sets the fail node of v to f
+func (m *Matcher) setFail(v, f int) {
+	if m.fails[v] >= 0 {
+		m.rev.remove(m.fails[v], v)
+	}
+	m.fails[v] = f
+	m.rev.push(f, v)
+}
+
+// failOf returns the fail node of the child by label c of parent
+func (m *Matcher) failOf(parent int, c byte) int {
+	if parent == 0 {
+		return 0
+	}
+	for f := m.fails[parent]; ; f = m.fails[f] {
+		if to, err := m.da.child(f, c); err == nil {
+			return to
+		}
+		if f == 0 {
+			return 0
+		}
+	}
+}
+
+// takeover returns nodes by label c from the nodes failing to parent,
+// whose longest suffix in the trie becomes the new node n
+func (m *Matcher) takeover(parent int, c byte, n int) []int {
+	var res []int
+	stack := []int{parent}
+	for len(stack) > 0 {
+		y := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for x := m.rev.first[y]; x >= 0; x = m.rev.next[x] {
+			if x == n {
+				continue
+			}
+			if to, err := m.da.child(x, c); err == nil {
+				// deeper nodes fail to to or to a longer suffix
+				if m.fails[to] >= 0 && m.depth[m.fails[to]] < m.depth[n] {
+					res = append(res, to)
+				}
+				continue
+			}
+			stack = append(stack, x)
+		}
+	}
+	return res
+}
+
+// relink updates outputs of v from its own value and its fail node,
+// it tells whether they changed
+func (m *Matcher) relink(v int) bool {
+	da := m.da
+	own := 0
+	if vk, err := da.vKeyOf(v); err == nil && da.vals[vk].Len > 0 {
+		own = vk
+	}
+	f := m.fails[v]
+	link := f != 0 && da.isEnd(f)
+	longest := own
+	if own == 0 {
+		longest = m.longest[f]
+	}
+	out := outNode{vKey: own, link: link}
+	changed := out != m.outputs[v] || longest != m.longest[v]
+	m.outputs[v], m.longest[v] = out, longest
+	if m.reversed {
+		first := da.earlier(own, m.first[f])
+		changed = changed || first != m.first[v]
+		m.first[v] = first
+	}
+	da.info[v].End = link
+	return changed
+}
+
+// refresh relinks v and the nodes failing to it, as long as outputs change
+func (m *Matcher) refresh(v int) {
+	m.relink(v)
+	stack := []int{v}
+	for len(stack) > 0 {
+		y := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for x := m.rev.first[y]; x >= 0; x = m.rev.next[x] {
+			if m.relink(x) {
+				stack = append(stack, x)
+			}
+		}
+	}
+}
+
+// path returns nodes of the existing path of key
+func (m *Matcher) path(key []byte) []int {
+	var ids []int
+	nid := 0
+	for _, b := range key {
+		to, err := m.da.child(nid, b)
+		if err != nil {
+			break
+		}
+		ids = append(ids, to)
+		nid = to
+	}
+	return ids
+}
+
+// update inserts key into the compiled matcher, repairing fail and
+// output links of the nodes depending on it, and returns the value key
+func (m *Matcher) update(key []byte, val interface{}) int {
+	da := m.da
+	m.buildRev()
+	d0 := len(m.path(key))
+	da.moved = m.move
+	k := da.insert(key, val)
+	da.moved = nil
+	m.grow()
+	ids := m.path(key)
+	dirty := make([]int, 0, 2*(len(ids)-d0)+1)
+	for j := d0; j < len(ids); j++ {
+		parent, n := 0, ids[j]
+		if j > 0 {
+			parent = ids[j-1]
+		}
+		m.depth[n] = j + 1
+		m.setFail(n, m.failOf(parent, key[j]))
+		dirty = append(dirty, n)
+		for _, x := range m.takeover(parent, key[j], n) {
+			m.setFail(x, n)
+			dirty = append(dirty, x)
+		}
+	}
+	dirty = append(dirty, ids[len(ids)-1])
+	for _, v := range dirty {
+		m.refresh(v)
+	}
+	if len(key) > m.maxLen {
+		m.maxLen = len(key)
+	}
+	if b := m.built(); b != nil {
+		b.insert(key, k)
+	}
+	return k
+}
+
+// Delete removes a key, it will return ErrNoPath if the key has not been
+// added. A compiled matcher is updated in place, like on Insert.
+func (m *Matcher) Delete(bs []byte) error {
+	if m.rewrites() {
+		bs = m.foldKey(bs)
+	}
+	if !m.compiled {
+		return m.da.Delete(bs)
+	}
+	ids := m.path(bs)
+	if len(ids) != len(bs) || len(bs) == 0 {
+		return ErrNoPath
+	}
+	m.buildRev()
+	if err := m.da.Delete(bs); err != nil {
+		return err
+	}
+	keep := len(m.path(bs))
+	removed := func(v int) bool {
+		d := m.depth[v]
+		return d > keep && d <= len(ids) && ids[d-1] == v
+	}
+	var dirty []int
+	// deepest first, nodes failing to a removed node are never removed
+	for i := len(ids) - 1; i >= keep; i-- {
+		r := ids[i]
+		f := m.fails[r]
+		for removed(f) {
+			f = m.fails[f]
+		}
+		for x := m.rev.first[r]; x >= 0; x = m.rev.first[r] {
+			m.setFail(x, f)
+			dirty = append(dirty, x)
+		}
+		m.rev.remove(m.fails[r], r)
+		m.clear(r)
+	}
+	if keep == len(ids) {
+		dirty = append(dirty, ids[keep-1])
+	}
+	for _, v := range dirty {
+		m.refresh(v)
+	}
+	if b := m.built(); b != nil {
+		b.delete(bs)
+	}
+	return nil
+}
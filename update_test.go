@@ -0,0 +1,116 @@
+package cedar
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	m := NewMatcher()
+	for i, word := range []string{"she", "hers"} {
+		m.Insert([]byte(word), i)
+	}
+	m.Compile()
+	seq := []byte("ushershertongher")
+	m.Insert([]byte("he"), 2)
+	m.Insert([]byte("her"), 3)
+	if got, want := fmt.Sprint(spans(m, seq)), "[1-3 2-3 2-4 2-5 5-7 6-7 6-8 13-14 13-15]"; got != want {
+		t.Errorf("after Insert got %s, want %s", got, want)
+	}
+	if err := m.Delete([]byte("he")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete([]byte("hers")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(spans(m, seq)), "[1-3 2-4 5-7 6-8 13-15]"; got != want {
+		t.Errorf("after Delete got %s, want %s", got, want)
+	}
+	for _, key := range []string{"he", "hers", "sh", "x"} {
+		if err := m.Delete([]byte(key)); err != ErrNoPath {
+			t.Errorf("Delete %s got %v, want ErrNoPath", key, err)
+		}
+	}
+	for _, key := range []string{"she", "her"} {
+		if err := m.Delete([]byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := m.Count(seq); got != 0 {
+		t.Errorf("empty matcher got %d matches", got)
+	}
+	m.Insert([]byte("her"), 0)
+	if got := m.Count(seq); got != 3 {
+		t.Errorf("got %d matches, want 3", got)
+	}
+}
+
+func TestUpdateRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abcd"[r.Intn(4)]
+		}
+		return b
+	}
+	for round := 0; round < 20; round++ {
+		kind := MatchKind(round % 4)
+		m := NewMatcher(WithMatchKind(kind))
+		// keys in insertion order, for leftmost-first ties
+		var keys []string
+		vals := map[string]int{}
+		insert := func(w []byte, v int) {
+			m.Insert(w, v)
+			keys = remove(keys, string(w))
+			keys = append(keys, string(w))
+			vals[string(w)] = v
+		}
+		for i := 0; i < 20; i++ {
+			insert(gen(1+r.Intn(6)), i)
+		}
+		m.Compile()
+		for op := 0; op < 300; op++ {
+			w := gen(1 + r.Intn(6))
+			if _, ok := vals[string(w)]; ok && r.Intn(2) == 0 {
+				if err := m.Delete(w); err != nil {
+					t.Fatalf("Delete %s: %v", w, err)
+				}
+				keys = remove(keys, string(w))
+				delete(vals, string(w))
+			} else {
+				insert(w, op)
+			}
+			if op%10 != 0 {
+				continue
+			}
+			fresh := NewMatcher(WithMatchKind(kind))
+			for _, k := range keys {
+				fresh.Insert([]byte(k), vals[k])
+			}
+			seq := gen(60)
+			got, want := values(m, seq), values(fresh, seq)
+			if got != want {
+				t.Fatalf("round %d op %d kind %d seq %s:\ngot  %s\nwant %s", round, op, kind, seq, got, want)
+			}
+		}
+	}
+}
+
+func values(m *Matcher, seq []byte) string {
+	var res []string
+	for mt := range m.All(seq) {
+		res = append(res, fmt.Sprintf("%d-%d:%v", mt.Start, mt.End, mt.Value))
+	}
+	return fmt.Sprint(res)
+}
+
+func remove(keys []string, key string) []string {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
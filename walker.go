@@ -0,0 +1,358 @@
+package cedar
+
+import "unicode/utf8"
+
+// MatchKind selects which matches a Matcher reports
+type MatchKind int
+
+const (
+	// MatchOverlapping reports every word ending at every position
+	MatchOverlapping MatchKind = iota
+	// MatchLeftmostFirst reports non-overlapping matches, preferring the
+	// leftmost start and then the word inserted first
+	MatchLeftmostFirst
+	// MatchLeftmostLongest reports non-overlapping matches, preferring the
+	// leftmost start and then the longest word
+	MatchLeftmostLongest
+	// MatchLongestPerEnd reports the longest word ending at each position,
+	// matches of different positions may overlap
+	MatchLongestPerEnd
+)
+
+// MatcherOption configures a Matcher in NewMatcher
+type MatcherOption func(*Matcher)
+
+// WithMatchKind sets match semantics of the Matcher, default is MatchOverlapping
+func WithMatchKind(kind MatchKind) MatcherOption {
+	return func(m *Matcher) {
+		m.kind = kind
+	}
+}
+
+func (m *Matcher) leftmost() bool {
+	return m.kind == MatchLeftmostFirst || m.kind == MatchLeftmostLongest
+}
+
+// walker feeds bytes one by one into a compiled matcher and emits matches
+// of the given kind. For leftmost kinds it keeps the last bytes of input
+// and decides which match starts at each position by blocks, once all
+// the keys starting there are known, see decide.
+// With whole word keys, a rune is only walked once the next rune is known.
+type walker struct {
+	m    *Matcher
+	kind MatchKind
+	emit func(matchAt)
+	nid  int
+	pos  int // positions walked
+	fed  int // positions committed to hist and flags
+	hist []byte
+	// rune and word flags of the last positions
+	flags []uint8
+	need  int
+	ahead []byte
+	// backward matcher, positions decided and states to decide
+	back   *backward
+	start  int
+	states []int
+	// decide positions as soon as possible instead of by blocks
+	eager bool
+}
+
+// leftmostBlock is the number of positions leftmost kinds decide at
+// once, in lengths of the longest key: the bytes of one more length
+// after a block are walked again with the next one.
+const leftmostBlock = 4
+
+const (
+	runeStart uint8 = 1 << iota
+	runeEnd
+	wordEnd  // the rune ending here is a word rune
+	wordNext // the rune right after here is a word rune
+)
+
+func newWalker(m *Matcher, kind MatchKind, emit func(matchAt)) *walker {
+	w := &walker{m: m, kind: kind, emit: emit}
+	if kind == MatchLeftmostFirst || kind == MatchLeftmostLongest {
+		// a block and the bytes after it, with room for one more rune
+		n := (leftmostBlock+1)*max(m.maxLen, 1) + 2*utf8.UTFMax
+		w.back, w.states = m.backward(), make([]int, n)
+		w.hist = make([]byte, n)
+		if m.runeSafe || m.hasWords {
+			w.flags = make([]uint8, n)
+		}
+		return w
+	}
+	// runes are committed before walking, keep room for one more rune
+	if m.hasWords {
+		w.hist = make([]byte, m.maxLen+1+utf8.UTFMax)
+	}
+	if m.runeSafe || m.hasWords {
+		w.flags = make([]uint8, m.maxLen+2+utf8.UTFMax)
+	}
+	return w
+}
+
+// offset returns the number of bytes fed
+func (w *walker) offset() int {
+	return w.fed + len(w.ahead)
+}
+
+// window returns the most bytes fed after the start of a match to come
+func (w *walker) window() int {
+	return max(len(w.hist), w.m.maxLen+1) + utf8.UTFMax
+}
+
+// feed consumes the next byte of input
+func (w *walker) feed(b byte) {
+	if w.hist == nil {
+		i := w.pos
+		w.pos, w.fed = w.pos+1, w.fed+1
+		if w.flags != nil {
+			w.flags[i%len(w.flags)] = w.boundary(b)
+		}
+		w.nid = w.m.next(w.nid, b)
+		w.step(i)
+		return
+	}
+	if !w.m.hasWords {
+		w.commit(b, w.boundary(b))
+		w.advance()
+		return
+	}
+	w.ahead = append(w.ahead, b)
+	w.decode(false)
+}
+
+// commit appends b with its flags to the history
+func (w *walker) commit(b byte, f uint8) {
+	w.hist[w.fed%len(w.hist)] = b
+	if w.flags != nil {
+		w.flags[w.fed%len(w.flags)] = f
+	}
+	w.fed++
+}
+
+// decode commits runes of ahead once the rune after them is complete
+func (w *walker) decode(final bool) {
+	for len(w.ahead) > 0 {
+		if !final && !utf8.FullRune(w.ahead) {
+			return
+		}
+		r, n := utf8.DecodeRune(w.ahead)
+		rest := w.ahead[n:]
+		if !final && !utf8.FullRune(rest) {
+			return
+		}
+		f := runeEnd
+		if w.m.isWord(r) {
+			f |= wordEnd
+		}
+		if len(rest) > 0 {
+			if next, _ := utf8.DecodeRune(rest); w.m.isWord(next) {
+				f |= wordNext
+			}
+		}
+		for j := 0; j < n; j++ {
+			var fj uint8
+			if j == 0 {
+				fj = runeStart
+			}
+			if j == n-1 {
+				fj |= f
+			}
+			w.commit(w.ahead[j], fj)
+		}
+		w.ahead = w.ahead[:copy(w.ahead, rest)]
+		w.advance()
+	}
+}
+
+// boundary tracks utf-8 sequences and returns rune flags of b
+func (w *walker) boundary(b byte) (f uint8) {
+	if w.need > 0 && b&0xC0 == 0x80 {
+		w.need--
+	} else {
+		f = runeStart
+		switch {
+		case b >= 0xF0:
+			w.need = 3
+		case b >= 0xE0:
+			w.need = 2
+		case b >= 0xC0:
+			w.need = 1
+		default:
+			w.need = 0
+		}
+	}
+	if w.need == 0 {
+		f |= runeEnd
+	}
+	return f
+}
+
+// step emits words ending at position i in non leftmost modes
+func (w *walker) step(i int) {
+	switch {
+	case w.nid == 0:
+	case w.kind == MatchLongestPerEnd:
+		if vk := w.longestAt(i); vk != 0 {
+			w.emit(matchAt{At: i, OutID: w.nid, VKey: vk})
+		}
+	case !w.m.da.isEnd(w.nid):
+	case w.flags != nil:
+		w.emitChecked(i)
+	default:
+		w.emit(matchAt{At: i, OutID: w.nid})
+	}
+}
+
+// accept tells whether the word vk ending at i passes boundary checks
+func (w *walker) accept(i, vk int) bool {
+	if w.flags == nil {
+		return true
+	}
+	v := w.m.da.vals[vk]
+	n := len(w.flags)
+	start := i - v.Len + 1
+	if w.flags[i%n]&runeEnd == 0 || w.flags[start%n]&runeStart == 0 {
+		return !w.m.runeSafe && !v.Word
+	}
+	if !v.Word {
+		return true
+	}
+	return w.flags[i%n]&wordNext == 0 && (start == 0 || w.flags[(start-1)%n]&wordEnd == 0)
+}
+
+// longestAt returns the longest accepted word ending at i
+func (w *walker) longestAt(i int) int {
+	vk := w.m.longest[w.nid]
+	if vk == 0 || w.accept(i, vk) {
+		return vk
+	}
+	for e := w.nid; e > 0; e = w.m.outLink(e) {
+		if vk := w.m.outputs[e].vKey; vk != 0 && w.accept(i, vk) {
+			return vk
+		}
+	}
+	return 0
+}
+
+// emitChecked emits accepted words ending at i one by one
+func (w *walker) emitChecked(i int) {
+	for e := w.nid; e > 0; e = w.m.outLink(e) {
+		if vk := w.m.outputs[e].vKey; vk != 0 && w.accept(i, vk) {
+			w.emit(matchAt{At: i, OutID: w.nid, VKey: vk})
+		}
+	}
+}
+
+// advance walks committed positions from the history, leftmost kinds
+// decide a block of positions once the bytes after it are known
+func (w *walker) advance() {
+	m := w.m
+	if w.back == nil {
+		for w.pos < w.fed {
+			i := w.pos
+			w.pos++
+			w.nid = m.next(w.nid, w.hist[i%len(w.hist)])
+			w.step(i)
+		}
+		return
+	}
+	n := max(m.maxLen, 1)
+	if !w.eager {
+		if w.fed-w.start >= (leftmostBlock+1)*n-1 {
+			w.decide(w.fed - n + 1)
+		}
+		return
+	}
+	// decide every position whose keys cannot reach past fed: keys
+	// starting before fed-n+1 or before the forward state are all known
+	for w.pos < w.fed {
+		w.nid = m.next(w.nid, w.hist[w.pos%len(w.hist)])
+		w.pos++
+	}
+	w.decide(max(w.fed-n+1, w.fed-m.depth[w.nid]))
+}
+
+// decide emits the leftmost matches starting from start up to to. The
+// backward matcher walks the history from fed down to start, its state
+// at a position gives the keys starting there and ending before fed.
+func (w *walker) decide(to int) {
+	if w.start >= to {
+		return
+	}
+	b, n := w.back.m, len(w.hist)
+	nid := 0
+	for i := w.fed - 1; i >= w.start; i-- {
+		nid = b.next(nid, w.hist[i%n])
+		if i < to {
+			w.states[i-w.start] = nid
+		}
+	}
+	s := w.start
+	for s < to {
+		k := w.preferred(s, w.states[s-w.start])
+		if k.vk == 0 {
+			s++
+			continue
+		}
+		s += k.len
+		w.emit(matchAt{At: s - 1, VKey: k.vk})
+	}
+	w.start = s
+}
+
+// preferred returns the accepted key starting at s preferred by the kind
+// of w, nid is the state of the backward matcher at s
+func (w *walker) preferred(s, nid int) backKey {
+	b := w.back
+	bk := b.m.longest[nid]
+	if w.kind == MatchLeftmostFirst {
+		bk = b.m.first[nid]
+	}
+	if bk == 0 {
+		return backKey{}
+	}
+	if k := b.keys[bk]; w.flags == nil || w.accept(s+k.len-1, k.vk) {
+		return k
+	}
+	// keys starting at s, the longest first
+	var best backKey
+	for e := nid; e > 0; e = b.m.outLink(e) {
+		bk := b.m.outputs[e].vKey
+		if bk == 0 {
+			continue
+		}
+		k := b.keys[bk]
+		if !w.accept(s+k.len-1, k.vk) {
+			continue
+		}
+		if w.kind == MatchLeftmostLongest {
+			return k
+		}
+		if best.vk == 0 || w.m.da.earlier(best.vk, k.vk) == k.vk {
+			best = k
+		}
+	}
+	return best
+}
+
+// settled returns the position before which no byte can be part of a
+// match to come
+func (w *walker) settled() int {
+	if w.back != nil {
+		return w.start
+	}
+	return w.pos - w.m.depth[w.nid]
+}
+
+// flush decides the last positions at the end of input
+func (w *walker) flush() {
+	if w.m.hasWords {
+		w.decode(true)
+	}
+	if w.back != nil {
+		w.decide(w.fed)
+	}
+}
@@ -0,0 +1,181 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// naiveMatch returns matches of kind in seq as "start-end" strings
+func naiveMatch(words []string, kind MatchKind, seq []byte) []string {
+	return naiveMatchFunc(words, kind, seq, nil)
+}
+
+// naiveMatchFunc is naiveMatch with hits filtered by keep
+func naiveMatchFunc(words []string, kind MatchKind, seq []byte, keep func(prio, start, end int) bool) []string {
+	type hit struct{ start, end, prio int }
+	var all []hit
+	for end := 0; end < len(seq); end++ {
+		for prio, w := range words {
+			if start := end - len(w) + 1; start >= 0 && bytes.Equal(seq[start:end+1], []byte(w)) &&
+				(keep == nil || keep(prio, start, end)) {
+				all = append(all, hit{start, end, prio})
+			}
+		}
+	}
+	var res []string
+	switch kind {
+	case MatchOverlapping, MatchLongestPerEnd:
+		for i := 0; i < len(all); {
+			// hits ending at the same position, the longest first
+			j := i
+			for ; j < len(all) && all[j].end == all[i].end; j++ {
+			}
+			sort.Slice(all[i:j], func(a, b int) bool { return all[i+a].start < all[i+b].start })
+			if kind == MatchLongestPerEnd {
+				j = i + 1
+			}
+			for ; i < j; i++ {
+				res = append(res, fmt.Sprintf("%d-%d", all[i].start, all[i].end))
+			}
+			for ; i < len(all) && all[i].end == all[j-1].end; i++ {
+			}
+		}
+		return res
+	}
+	for from := 0; ; {
+		var best *hit
+		for i := range all {
+			h := &all[i]
+			if h.start < from {
+				continue
+			}
+			if best == nil || h.start < best.start ||
+				(h.start == best.start && kind == MatchLeftmostLongest && h.end > best.end) ||
+				(h.start == best.start && kind == MatchLeftmostFirst && h.prio < best.prio) {
+				best = h
+			}
+		}
+		if best == nil {
+			return res
+		}
+		res = append(res, fmt.Sprintf("%d-%d", best.start, best.end))
+		from = best.end + 1
+	}
+}
+
+func spans(m *Matcher, seq []byte) []string {
+	return spansOf(m.Match(seq), seq)
+}
+
+func spansOf(resp *Response, seq []byte) []string {
+	defer resp.Release()
+	var res []string
+	for resp.HasNext() {
+		for _, itr := range resp.NextMatchItem(seq) {
+			res = append(res, fmt.Sprintf("%d-%d", itr.At-itr.KLen+1, itr.At))
+		}
+	}
+	return res
+}
+
+func TestMatchKind(t *testing.T) {
+	words := []string{"she", "he", "her", "hers", "abcd", "bc", "ab"}
+	seq := []byte("hershertongher abcd")
+	cases := []struct {
+		kind MatchKind
+		want string
+	}{
+		{MatchLeftmostFirst, "[0-1 3-5 11-12 15-18]"},
+		{MatchLeftmostLongest, "[0-3 4-6 11-13 15-18]"},
+		{MatchLongestPerEnd, "[0-1 0-2 0-3 3-5 4-6 11-12 11-13 15-16 16-17 15-18]"},
+	}
+	for _, c := range cases {
+		m := NewMatcher(WithMatchKind(c.kind))
+		for i, word := range words {
+			m.Insert([]byte(word), i)
+		}
+		if got := fmt.Sprint(spans(m, seq)); got != c.want {
+			t.Errorf("kind %d: got %s, want %s", c.kind, got, c.want)
+		}
+	}
+}
+
+func TestMatchKindRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	gen := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[r.Intn(3)]
+		}
+		return b
+	}
+	for round := 0; round < 200; round++ {
+		var words []string
+		seen := map[string]bool{}
+		for len(words) < 6 {
+			w := string(gen(1 + r.Intn(4)))
+			if !seen[w] {
+				seen[w] = true
+				words = append(words, w)
+			}
+		}
+		seq := gen(40)
+		for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostFirst, MatchLeftmostLongest, MatchLongestPerEnd} {
+			m := NewMatcher(WithMatchKind(kind))
+			for i, w := range words {
+				m.Insert([]byte(w), i)
+			}
+			got, want := fmt.Sprint(spans(m, seq)), fmt.Sprint(naiveMatch(words, kind, seq))
+			if got != want {
+				t.Fatalf("kind %d words %q seq %s: got %s, want %s", kind, words, seq, got, want)
+			}
+		}
+	}
+}
+
+func TestOutputsOrder(t *testing.T) {
+	// the end flag of "bc" depends on "c", whatever the insert order is
+	for _, words := range [][]string{{"abcx", "bcd", "c"}, {"c", "bcd", "abcx"}} {
+		m := NewMatcher()
+		for i, w := range words {
+			m.Insert([]byte(w), i)
+		}
+		if got := fmt.Sprint(spans(m, []byte("abc"))); got != "[2-2]" {
+			t.Errorf("words %q: got %s", words, got)
+		}
+	}
+}
+
+func TestLeftmostLinear(t *testing.T) {
+	// the long key is walked from every position but never matches,
+	// which took quadratic time when input was replayed after each match
+	seq := bytes.Repeat([]byte("a"), 1<<20)
+	for _, kind := range []MatchKind{MatchLeftmostFirst, MatchLeftmostLongest} {
+		m := NewMatcher(WithMatchKind(kind))
+		m.Insert([]byte("a"), 0)
+		m.Insert(append(bytes.Repeat([]byte("a"), 1000), 'b'), 1)
+		if n := m.Count(seq); n != len(seq) {
+			t.Errorf("kind %d: got %d matches, want %d", kind, n, len(seq))
+		}
+	}
+
+	// a key inserted again loses its priority
+	m := NewMatcher(WithMatchKind(MatchLeftmostFirst))
+	m.Insert([]byte("ab"), 0)
+	m.Insert([]byte("abc"), 1)
+	seq = []byte("abcab")
+	if got := fmt.Sprint(spans(m, seq)); got != "[0-1 3-4]" {
+		t.Errorf("got %s", got)
+	}
+	m.Insert([]byte("ab"), 2)
+	if got := fmt.Sprint(spans(m, seq)); got != "[0-2 3-4]" {
+		t.Errorf("after Insert got %s", got)
+	}
+	m.Delete([]byte("abc"))
+	if got := fmt.Sprint(spans(m, seq)); got != "[0-1 3-4]" {
+		t.Errorf("after Delete got %s", got)
+	}
+}
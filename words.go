@@ -0,0 +1,51 @@
+package cedar
+
+import (
+	"unicode"
+)
+
+type wordOptions struct {
+	all    bool
+	isWord func(rune) bool
+}
+
+// WithWholeWords only reports keys whose neighbours are not word runes.
+// It applies to every key added by Insert, use InsertWord to mix
+// whole word keys with substring keys.
+func WithWholeWords() MatcherOption {
+	return func(m *Matcher) {
+		m.words.all = true
+	}
+}
+
+// WithWordRunes sets the predicate of word runes for whole word keys,
+// default is UnicodeWord.
+func WithWordRunes(isWord func(rune) bool) MatcherOption {
+	return func(m *Matcher) {
+		m.words.isWord = isWord
+	}
+}
+
+// ASCIIWord reports whether r is one of [0-9A-Za-z_]
+func ASCIIWord(r rune) bool {
+	return r == '_' || '0' <= r && r <= '9' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+// UnicodeWord reports whether r is a letter, mark, digit or '_'
+func UnicodeWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// InsertWord adds a key which only matches as a whole word,
+// it returns errors like Insert.
+func (m *Matcher) InsertWord(bs []byte, val interface{}) error {
+	_, err := m.insert(bs, val, true)
+	return err
+}
+
+func (m *Matcher) isWord(r rune) bool {
+	if m.words.isWord == nil {
+		return UnicodeWord(r)
+	}
+	return m.words.isWord(r)
+}
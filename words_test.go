@@ -0,0 +1,93 @@
+package cedar
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWholeWords(t *testing.T) {
+	seq := []byte("the her he when he. hé")
+	cases := []struct {
+		opts []MatcherOption
+		want string
+	}{
+		{[]MatcherOption{WithWholeWords()}, "[8-9 16-17]"},
+		{[]MatcherOption{WithWholeWords(), WithMatchKind(MatchLeftmostLongest)}, "[8-9 16-17]"},
+		// 'é' is not a word rune in ASCII mode
+		{[]MatcherOption{WithWholeWords(), WithWordRunes(ASCIIWord)}, "[8-9 16-17 20-20]"},
+	}
+	for _, c := range cases {
+		m := NewMatcher(c.opts...)
+		m.Insert([]byte("he"), 0)
+		m.Insert([]byte("h"), 1)
+		if got := fmt.Sprint(spans(m, seq)); got != c.want {
+			t.Errorf("got %s, want %s", got, c.want)
+		}
+	}
+}
+
+func TestMixedWords(t *testing.T) {
+	m := NewMatcher()
+	m.InsertWord([]byte("he"), 0)
+	m.Insert([]byte("her"), 1)
+	seq := []byte("the ether he")
+	want := "[6-8 10-11]"
+	if got := fmt.Sprint(spans(m, seq)); got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	s := m.NewScanner(iotest.OneByteReader(bytes.NewReader(seq)))
+	var got []string
+	for s.Scan() {
+		for _, itr := range s.Tokens() {
+			got = append(got, fmt.Sprintf("%d-%d", itr.At-itr.KLen+1, itr.At))
+		}
+	}
+	if fmt.Sprint(got) != want {
+		t.Fatalf("scanner got %s, want %s", got, want)
+	}
+}
+
+func TestWholeWordsRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	gen := func(n int, alpha string) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = alpha[r.Intn(len(alpha))]
+		}
+		return b
+	}
+	for round := 0; round < 200; round++ {
+		var words []string
+		seen := map[string]bool{}
+		for len(words) < 6 {
+			w := string(gen(1+r.Intn(3), "ab"))
+			if !seen[w] {
+				seen[w] = true
+				words = append(words, w)
+			}
+		}
+		seq := gen(40, "ab ")
+		whole := func(prio int) bool { return prio%2 == 0 }
+		keep := func(prio, start, end int) bool {
+			return !whole(prio) || (start == 0 || seq[start-1] == ' ') && (end == len(seq)-1 || seq[end+1] == ' ')
+		}
+		for _, kind := range []MatchKind{MatchOverlapping, MatchLeftmostFirst, MatchLeftmostLongest, MatchLongestPerEnd} {
+			m := NewMatcher(WithMatchKind(kind))
+			for i, w := range words {
+				if whole(i) {
+					m.InsertWord([]byte(w), i)
+				} else {
+					m.Insert([]byte(w), i)
+				}
+			}
+			want := naiveMatchFunc(words, kind, seq, keep)
+			got := spans(m, seq)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("kind %d words %q seq %q: got %s, want %s", kind, words, seq, got, want)
+			}
+		}
+	}
+}